@@ -0,0 +1,251 @@
+// Package accesslog writes a line for each request to the provider's API and function routes
+// in the Common Log Format, the Combined Log Format or as JSON.
+//
+// The Common and Combined formats follow the Apache definitions so that they can be read by
+// existing tools, the JSON format adds the latency, function, namespace and call ID.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// defaultExcludePaths are called frequently by probes and scrapes.
+var defaultExcludePaths = []string{"/healthz", "/metrics"}
+
+// Config for the access log middleware.
+type Config struct {
+	// Format is types.AccessLogFormatCommon, types.AccessLogFormatCombined or
+	// types.AccessLogFormatJSON.
+	Format string
+
+	// Writer receives one line per request, with a default of os.Stdout. Wrap it with
+	// NewSyncWriter to share it between several middlewares, such as one per listener.
+	Writer io.Writer
+
+	// SampleRatio is the fraction of requests which are logged, requests which fail with a
+	// 5xx status are always logged. The default of 0 logs all requests.
+	SampleRatio float64
+
+	// ExcludePaths are not logged, a path ending in "/" excludes all paths below it. The
+	// default is "/healthz" and "/metrics".
+	ExcludePaths []string
+
+	// PathPrefix is removed from the path of requests before they are matched against the
+	// ExcludePaths, for routes served below a prefix such as "/provider/v1".
+	PathPrefix string
+}
+
+// syncWriter serializes the lines written by the middlewares which share it.
+type syncWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewSyncWriter wraps w so that each Write is completed before the next one starts, a nil
+// w is os.Stdout. Writers which are already wrapped are returned as they are.
+func NewSyncWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*syncWriter); ok {
+		return w
+	}
+	if w == nil {
+		w = os.Stdout
+	}
+
+	return &syncWriter{w: w}
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.w.Write(p)
+}
+
+// ConfigFromFaaSConfig returns the access log Config for the AccessLog fields of the FaaSConfig.
+func ConfigFromFaaSConfig(config types.FaaSConfig) Config {
+	return Config{
+		Format:       config.AccessLogFormat,
+		Writer:       config.AccessLogWriter,
+		SampleRatio:  config.AccessLogSampleRatio,
+		ExcludePaths: config.AccessLogExcludePaths,
+	}
+}
+
+// entry is a single request in the access log.
+type entry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote_addr"`
+	Actor     string    `json:"actor,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_seconds"`
+	Function  string    `json:"function,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	CallID    string    `json:"call_id,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// New creates a mux.MiddlewareFunc which writes a line to the access log for each request.
+// An error is returned for an unknown Format.
+func New(config Config) (func(http.Handler) http.Handler, error) {
+	switch config.Format {
+	case types.AccessLogFormatCommon, types.AccessLogFormatCombined, types.AccessLogFormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format: %q", config.Format)
+	}
+
+	config.Writer = NewSyncWriter(config.Writer)
+	if config.SampleRatio <= 0 || config.SampleRatio > 1 {
+		config.SampleRatio = 1
+	}
+	if config.ExcludePaths == nil {
+		config.ExcludePaths = defaultExcludePaths
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if excluded(config.ExcludePaths, strings.TrimPrefix(r.URL.Path, config.PathPrefix)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ww := httputil.NewHttpWriteInterceptor(w)
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() < http.StatusInternalServerError &&
+				config.SampleRatio < 1 && rand.Float64() >= config.SampleRatio {
+				return
+			}
+
+			e := newEntry(r, ww, start)
+
+			var line []byte
+			switch config.Format {
+			case types.AccessLogFormatJSON:
+				line, _ = json.Marshal(e)
+				line = append(line, '\n')
+			case types.AccessLogFormatCombined:
+				line = []byte(e.common() + fmt.Sprintf(" %q %q\n", orDash(e.Referer), orDash(e.UserAgent)))
+			default:
+				line = []byte(e.common() + "\n")
+			}
+
+			config.Writer.Write(line)
+		})
+	}, nil
+}
+
+func newEntry(r *http.Request, ww *httputil.HttpWriteInterceptor, start time.Time) entry {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	actor, _, _ := r.BasicAuth()
+
+	e := entry{
+		Time:      start,
+		Remote:    remote,
+		Actor:     actor,
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Protocol:  r.Proto,
+		Status:    ww.Status(),
+		Bytes:     ww.BytesWritten(),
+		Duration:  time.Since(start).Seconds(),
+		CallID:    httputil.CallID(r),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+
+	if functionName := functionName(r); functionName != "" {
+		e.Function = functionName
+		if i := strings.LastIndex(functionName, "."); i > 0 {
+			e.Function, e.Namespace = functionName[:i], functionName[i+1:]
+		}
+	}
+
+	return e
+}
+
+// common formats the entry in the Common Log Format.
+func (e entry) common() string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = fmt.Sprintf("%d", e.Bytes)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		e.Remote, orDash(escape(e.Actor)), e.Time.Format(clfTimeFormat),
+		e.Method, e.Path, e.Protocol, e.Status, bytes)
+}
+
+// functionName returns the {name} variable of the routes which take a function name.
+func functionName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil || !strings.Contains(template, "function/{name") && !strings.Contains(template, "/webhook/{name") {
+		return ""
+	}
+
+	return mux.Vars(r)["name"]
+}
+
+func excluded(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escape replaces spaces, quotes, backslashes and non-printable bytes with "\xhh" as
+// Apache does, so that a value given by the caller, such as the basic auth username,
+// cannot add fields or lines to the Common and Combined formats.
+func escape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\x%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -0,0 +1,249 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func newRouter(t *testing.T, config Config) *mux.Router {
+	t.Helper()
+
+	accessLog, err := New(config)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(httputil.CallIDMiddleware)
+	r.Use(accessLog)
+
+	r.HandleFunc("/function/{name:[-a-zA-Z_0-9.]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	r.HandleFunc("/system/functions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.HandleFunc("/system/info", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	return r
+}
+
+func Test_New_UnknownFormat(t *testing.T) {
+	if _, err := New(Config{Format: "apache"}); err == nil {
+		t.Errorf("want error for unknown format, got nil")
+	}
+}
+
+func Test_AccessLog_Common(t *testing.T) {
+	var out bytes.Buffer
+	r := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: &out})
+
+	req := httptest.NewRequest(http.MethodGet, "/function/env.openfaas-fn?q=1", nil)
+	req.RemoteAddr = "10.0.0.1:41234"
+	req.SetBasicAuth("admin", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	if !strings.HasPrefix(line, "10.0.0.1 - admin [") {
+		t.Errorf("want line to start with host and actor, got: %q", line)
+	}
+	if !strings.HasSuffix(line, `] "GET /function/env.openfaas-fn?q=1 HTTP/1.1" 200 5`+"\n") {
+		t.Errorf("want request line, status and bytes, got: %q", line)
+	}
+}
+
+func Test_AccessLog_Common_EscapesActor(t *testing.T) {
+	var out bytes.Buffer
+	r := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: &out})
+
+	req := httptest.NewRequest(http.MethodGet, "/system/info", nil)
+	req.RemoteAddr = "10.0.0.1:41234"
+	req.SetBasicAuth("admin \"x\"\n10.0.0.2 - root", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Errorf("want a single line, got: %q", line)
+	}
+	if !strings.HasPrefix(line, `10.0.0.1 - admin\x20\x22x\x22\x0a10.0.0.2\x20-\x20root [`) {
+		t.Errorf("want the actor to be escaped, got: %q", line)
+	}
+}
+
+func Test_AccessLog_Combined(t *testing.T) {
+	var out bytes.Buffer
+	r := newRouter(t, Config{Format: types.AccessLogFormatCombined, Writer: &out})
+
+	req := httptest.NewRequest(http.MethodGet, "/system/info", nil)
+	req.Header.Set("User-Agent", "faas-cli/0.17")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	if !strings.HasSuffix(line, `"GET /system/info HTTP/1.1" 204 - "-" "faas-cli/0.17"`+"\n") {
+		t.Errorf("want combined line, got: %q", line)
+	}
+}
+
+func Test_AccessLog_JSON(t *testing.T) {
+	var out bytes.Buffer
+	r := newRouter(t, Config{Format: types.AccessLogFormatJSON, Writer: &out})
+
+	req := httptest.NewRequest(http.MethodPost, "/function/env.openfaas-fn", nil)
+	req.Header.Set(httputil.CallIDHeader, "call-1")
+	req.SetBasicAuth("admin", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got entry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("want JSON line, got: %q, error: %s", out.String(), err)
+	}
+
+	if got.Status != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, got.Status)
+	}
+	if got.Bytes != 5 {
+		t.Errorf("want bytes 5, got %d", got.Bytes)
+	}
+	if got.Function != "env" || got.Namespace != "openfaas-fn" {
+		t.Errorf("want function env in openfaas-fn, got %q in %q", got.Function, got.Namespace)
+	}
+	if got.Actor != "admin" {
+		t.Errorf("want actor admin, got %q", got.Actor)
+	}
+	if got.CallID != "call-1" {
+		t.Errorf("want call_id call-1, got %q", got.CallID)
+	}
+	if got.Duration <= 0 {
+		t.Errorf("want duration_seconds > 0, got %f", got.Duration)
+	}
+}
+
+func Test_AccessLog_ExcludePaths(t *testing.T) {
+	cases := []struct {
+		name    string
+		exclude []string
+		path    string
+		want    bool
+	}{
+		{name: "healthz excluded by default", path: "/healthz", want: false},
+		{name: "function logged by default", path: "/function/env", want: true},
+		{name: "exact path", exclude: []string{"/system/info"}, path: "/system/info", want: false},
+		{name: "prefix", exclude: []string{"/function/"}, path: "/function/env", want: false},
+		{name: "no prefix without slash", exclude: []string{"/function"}, path: "/function/env", want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: &out, ExcludePaths: tc.exclude})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if got := out.Len() > 0; got != tc.want {
+				t.Errorf("want logged: %v, got: %v, output: %q", tc.want, got, out.String())
+			}
+		})
+	}
+}
+
+func Test_AccessLog_SamplingKeepsErrors(t *testing.T) {
+	var out bytes.Buffer
+	r := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: &out, SampleRatio: 0.000001})
+
+	for i := 0; i < 10; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/system/functions", nil))
+	}
+
+	if got := strings.Count(out.String(), "\n"); got != 10 {
+		t.Errorf("want all 10 errors logged, got %d", got)
+	}
+}
+
+func Test_AccessLog_PathPrefix(t *testing.T) {
+	var out bytes.Buffer
+	accessLog, err := New(Config{Format: types.AccessLogFormatJSON, Writer: &out, PathPrefix: "/provider/v1"})
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	router := mux.NewRouter()
+	r := router.PathPrefix("/provider/v1").Subrouter()
+	r.Use(accessLog)
+	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	r.HandleFunc("/webhook/{name:[-a-zA-Z_0-9.]+}", func(w http.ResponseWriter, r *http.Request) {})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/provider/v1/healthz", nil))
+	if out.Len() > 0 {
+		t.Errorf("want /healthz to be excluded below the prefix, got: %q", out.String())
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/provider/v1/webhook/deploy.openfaas-fn", nil))
+
+	var got entry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("want JSON line, got: %q, error: %s", out.String(), err)
+	}
+	if got.Function != "deploy" || got.Namespace != "openfaas-fn" {
+		t.Errorf("want function deploy in openfaas-fn, got %q in %q", got.Function, got.Namespace)
+	}
+}
+
+// overlapWriter fails the test when two writes are in progress at once.
+type overlapWriter struct {
+	t       *testing.T
+	writing int32
+	lines   int32
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if !atomic.CompareAndSwapInt32(&w.writing, 0, 1) {
+		w.t.Errorf("want writes to be serialized")
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&w.lines, 1)
+	atomic.StoreInt32(&w.writing, 0)
+
+	return len(p), nil
+}
+
+func Test_NewSyncWriter_SharedBetweenMiddlewares(t *testing.T) {
+	out := &overlapWriter{t: t}
+	writer := NewSyncWriter(out)
+
+	if NewSyncWriter(writer) != writer {
+		t.Errorf("want a wrapped writer to be returned as it is")
+	}
+
+	public := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: writer})
+	admin := newRouter(t, Config{Format: types.AccessLogFormatCommon, Writer: writer})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, r := range []*mux.Router{public, admin} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/system/info", nil))
+			}()
+		}
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&out.lines); got != 20 {
+		t.Errorf("want 20 lines, got %d", got)
+	}
+}
@@ -0,0 +1,293 @@
+// Package connector routes events from a message broker, such as Kafka or MQTT, to the
+// functions which subscribe to its topic.
+//
+// Functions subscribe with the TopicAnnotation, the topic map is rebuilt periodically with
+// a lister.FunctionLister. Invoke fans an event out to each subscribed function through the
+// function proxy, and responses are passed to any ResponseReceiver.
+package connector
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/lister"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// TopicAnnotation is a comma-separated list of topics which the function subscribes to.
+	TopicAnnotation = "topic"
+
+	// TopicHeader is added to each invocation with the topic of the event.
+	TopicHeader = "X-Topic"
+
+	defaultRefreshInterval = 30 * time.Second
+	defaultInvokeTimeout   = time.Minute
+	defaultMaxConcurrency  = 10
+)
+
+// Config configures how functions are discovered and invoked.
+type Config struct {
+	// Namespaces to discover functions in, with a default of the provider's default namespace.
+	Namespaces []string
+
+	// RefreshInterval is how often the topic map is rebuilt, with a default of 30s.
+	RefreshInterval time.Duration
+
+	// InvokeTimeout limits each invocation, with a default of 1m.
+	InvokeTimeout time.Duration
+
+	// MaxConcurrency limits the invocations in progress across all calls to Invoke,
+	// with a default of 10.
+	MaxConcurrency int
+
+	// Logger is used for errors building the topic map, with a default of slog.Default().
+	Logger *slog.Logger
+}
+
+// InvokerResponse is the result of invoking a function for an event.
+type InvokerResponse struct {
+	Topic      string
+	Function   string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Duration   time.Duration
+
+	// Error is set when the function could not be invoked.
+	Error error
+}
+
+// ResponseReceiver is given the response of each invocation, for example to publish
+// it back to the broker.
+type ResponseReceiver interface {
+	Response(res InvokerResponse)
+}
+
+// ResponseReceiverFunc adapts a function to a ResponseReceiver.
+type ResponseReceiverFunc func(res InvokerResponse)
+
+func (f ResponseReceiverFunc) Response(res InvokerResponse) {
+	f(res)
+}
+
+// Connector invokes the functions subscribed to a topic.
+type Connector struct {
+	config  Config
+	lister  lister.FunctionLister
+	invoker http.Handler
+	limit   chan struct{}
+
+	lock      sync.RWMutex
+	topics    map[string][]string
+	receivers []ResponseReceiver
+}
+
+// New creates a Connector which discovers functions with lister and invokes them through
+// invoker, usually the router returned by bootstrap.Router(), or any other handler serving
+// the /function/ routes. Call Start to keep the topic map up to date.
+//
+// Note that this will panic if `lister` or `invoker` is nil.
+func New(config Config, lister lister.FunctionLister, invoker http.Handler) *Connector {
+	if lister == nil {
+		panic("New: empty function lister, cannot be nil")
+	}
+	if invoker == nil {
+		panic("New: empty invoker, cannot be nil")
+	}
+
+	if len(config.Namespaces) == 0 {
+		config.Namespaces = []string{""}
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	if config.InvokeTimeout <= 0 {
+		config.InvokeTimeout = defaultInvokeTimeout
+	}
+	if config.MaxConcurrency < 1 {
+		config.MaxConcurrency = defaultMaxConcurrency
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	return &Connector{
+		config:  config,
+		lister:  lister,
+		invoker: invoker,
+		limit:   make(chan struct{}, config.MaxConcurrency),
+		topics:  map[string][]string{},
+	}
+}
+
+// Subscribe adds a receiver for the response of each invocation.
+func (c *Connector) Subscribe(receiver ResponseReceiver) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.receivers = append(c.receivers, receiver)
+}
+
+// Start builds the topic map and then refreshes it until ctx is done, this function is blocking.
+func (c *Connector) Start(ctx context.Context) {
+	if err := c.Refresh(ctx); err != nil {
+		c.config.Logger.Error("error building topic map", "error", err.Error())
+	}
+
+	ticker := time.NewTicker(c.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				c.config.Logger.Error("error refreshing topic map", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Refresh rebuilds the topic map from the functions in each namespace. The current map
+// is kept when a namespace cannot be listed.
+func (c *Connector) Refresh(ctx context.Context) error {
+	topics := map[string][]string{}
+
+	for _, namespace := range c.config.Namespaces {
+		functions, err := c.lister.ListFunctions(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		for _, fn := range functions {
+			for _, topic := range topicsFromFunction(fn) {
+				topics[topic] = append(topics[topic], lister.QualifiedName(fn))
+			}
+		}
+	}
+
+	for _, functions := range topics {
+		sort.Strings(functions)
+	}
+
+	c.lock.Lock()
+	c.topics = topics
+	c.lock.Unlock()
+
+	return nil
+}
+
+// Topics returns a copy of the topic map.
+func (c *Connector) Topics() map[string][]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	topics := make(map[string][]string, len(c.topics))
+	for topic, functions := range c.topics {
+		topics[topic] = append([]string(nil), functions...)
+	}
+
+	return topics
+}
+
+// Invoke sends the event to each function subscribed to the topic and waits for the
+// responses, which are also passed to the receivers.
+func (c *Connector) Invoke(topic string, body []byte, headers http.Header) []InvokerResponse {
+	return c.InvokeWithContext(context.Background(), topic, body, headers)
+}
+
+// InvokeWithContext is Invoke with a context to cancel the invocations.
+func (c *Connector) InvokeWithContext(ctx context.Context, topic string, body []byte, headers http.Header) []InvokerResponse {
+	c.lock.RLock()
+	functions := c.topics[topic]
+	receivers := c.receivers
+	c.lock.RUnlock()
+
+	responses := make([]InvokerResponse, len(functions))
+
+	wg := sync.WaitGroup{}
+	for i, functionName := range functions {
+		wg.Add(1)
+		go func(i int, functionName string) {
+			defer wg.Done()
+
+			res := c.invoke(ctx, topic, functionName, body, headers)
+			recordInvocation(res)
+
+			for _, receiver := range receivers {
+				receiver.Response(res)
+			}
+			responses[i] = res
+		}(i, functionName)
+	}
+
+	wg.Wait()
+
+	return responses
+}
+
+// invoke calls the function through the proxy once below the MaxConcurrency.
+func (c *Connector) invoke(ctx context.Context, topic, functionName string, body []byte, headers http.Header) InvokerResponse {
+	res := InvokerResponse{
+		Topic:    topic,
+		Function: functionName,
+	}
+
+	select {
+	case c.limit <- struct{}{}:
+		defer func() { <-c.limit }()
+	case <-ctx.Done():
+		res.Error = ctx.Err()
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.InvokeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/function/"+functionName, bytes.NewReader(body))
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	if headers != nil {
+		req.Header = headers.Clone()
+	}
+	req.Header.Set(TopicHeader, topic)
+
+	start := time.Now()
+	w := httputil.NewBufferedResponseWriter()
+	c.invoker.ServeHTTP(w, req)
+
+	res.StatusCode = w.Status()
+	res.Header = w.Header()
+	res.Body = w.Body()
+	res.Duration = time.Since(start)
+
+	return res
+}
+
+// topicsFromFunction returns the topics in the TopicAnnotation of the function.
+func topicsFromFunction(fn types.FunctionStatus) []string {
+	if fn.Annotations == nil {
+		return nil
+	}
+
+	var topics []string
+	for _, topic := range strings.Split((*fn.Annotations)[TopicAnnotation], ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics
+}
@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type fakeLister struct {
+	functions map[string][]types.FunctionStatus
+	err       error
+}
+
+func (l *fakeLister) ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	return l.functions[namespace], nil
+}
+
+func subscribedFunction(name, namespace, topics string) types.FunctionStatus {
+	return types.FunctionStatus{
+		Name:        name,
+		Namespace:   namespace,
+		Annotations: &map[string]string{TopicAnnotation: topics},
+	}
+}
+
+func newFunctionRouter(handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}", handler)
+	return router
+}
+
+func Test_Connector_Refresh(t *testing.T) {
+	lister := &fakeLister{functions: map[string][]types.FunctionStatus{
+		"openfaas-fn": {
+			subscribedFunction("audit", "openfaas-fn", "orders, payments"),
+			subscribedFunction("billing", "openfaas-fn", "payments"),
+			{Name: "unsubscribed", Namespace: "openfaas-fn"},
+		},
+		"staging": {
+			subscribedFunction("audit", "staging", "orders"),
+		},
+	}}
+
+	c := New(Config{Namespaces: []string{"openfaas-fn", "staging"}}, lister, http.NotFoundHandler())
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"orders":   {"audit.openfaas-fn", "audit.staging"},
+		"payments": {"audit.openfaas-fn", "billing.openfaas-fn"},
+	}
+
+	if got := c.Topics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want topics %v, got %v", want, got)
+	}
+}
+
+func Test_Connector_Refresh_KeepsTopicsOnError(t *testing.T) {
+	lister := &fakeLister{functions: map[string][]types.FunctionStatus{
+		"": {subscribedFunction("audit", "", "orders")},
+	}}
+
+	c := New(Config{}, lister, http.NotFoundHandler())
+	c.Refresh(context.Background())
+
+	lister.err = errors.New("provider unavailable")
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("want error from Refresh")
+	}
+
+	if got := c.Topics()["orders"]; len(got) != 1 {
+		t.Errorf("want topic map to be kept, got %v", got)
+	}
+}
+
+func Test_Connector_Invoke(t *testing.T) {
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Topic-Received", r.Header.Get(TopicHeader))
+		w.Write([]byte(mux.Vars(r)["name"] + ":" + string(body) + ":" + r.Header.Get("X-Source")))
+	})
+
+	lister := &fakeLister{functions: map[string][]types.FunctionStatus{
+		"": {
+			subscribedFunction("audit", "", "orders"),
+			subscribedFunction("billing", "", "orders"),
+		},
+	}}
+
+	c := New(Config{}, lister, router)
+	c.Refresh(context.Background())
+
+	var lock sync.Mutex
+	received := map[string]string{}
+	c.Subscribe(ResponseReceiverFunc(func(res InvokerResponse) {
+		lock.Lock()
+		defer lock.Unlock()
+		received[res.Function] = string(res.Body)
+	}))
+
+	responses := c.Invoke("orders", []byte("order-1"), http.Header{"X-Source": []string{"kafka"}})
+
+	if len(responses) != 2 {
+		t.Fatalf("want 2 responses, got %d", len(responses))
+	}
+
+	for _, res := range responses {
+		if res.Error != nil || res.StatusCode != http.StatusOK {
+			t.Errorf("want 200 for %s, got %d %v", res.Function, res.StatusCode, res.Error)
+		}
+		if got := res.Header.Get("X-Topic-Received"); got != "orders" {
+			t.Errorf("want %s orders, got %q", TopicHeader, got)
+		}
+	}
+
+	want := map[string]string{
+		"audit":   "audit:order-1:kafka",
+		"billing": "billing:order-1:kafka",
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("want responses %v, got %v", want, received)
+	}
+
+	if got := c.Invoke("unknown", nil, nil); len(got) != 0 {
+		t.Errorf("want no responses for a topic without functions, got %d", len(got))
+	}
+}
+
+func Test_Connector_MaxConcurrency(t *testing.T) {
+	var running, maxRunning int32
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+
+	var functions []types.FunctionStatus
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		functions = append(functions, subscribedFunction(name, "", "orders"))
+	}
+
+	c := New(Config{MaxConcurrency: 2}, &fakeLister{functions: map[string][]types.FunctionStatus{"": functions}}, router)
+	c.Refresh(context.Background())
+
+	c.Invoke("orders", nil, nil)
+
+	if got := atomic.LoadInt32(&maxRunning); got != 2 {
+		t.Errorf("want at most 2 concurrent invocations, got %d", got)
+	}
+}
@@ -0,0 +1,33 @@
+package connector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// invocationTotal counts invocations made for events partitioned by topic, function name
+// and status code. The code is "error" when the function could not be invoked.
+var invocationTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "connector_invocation_total",
+	Help:      "Total number of function invocations made by the connector.",
+}, []string{"topic", "function_name", "code"})
+
+// invocationDuration observes the duration of invocations made for events.
+var invocationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: "provider",
+	Name:      "connector_invocation_duration_seconds",
+	Help:      "Duration of function invocations made by the connector.",
+}, []string{"topic", "function_name"})
+
+func recordInvocation(res InvokerResponse) {
+	code := "error"
+	if res.Error == nil {
+		code = strconv.Itoa(res.StatusCode)
+		invocationDuration.WithLabelValues(res.Topic, res.Function).Observe(res.Duration.Seconds())
+	}
+
+	invocationTotal.WithLabelValues(res.Topic, res.Function, code).Inc()
+}
@@ -0,0 +1,305 @@
+// Package grpc provides a gRPC front door for function invocations.
+//
+// Two kinds of gRPC request are supported, both of which are served by the same router
+// as the /function/ HTTP routes, so that they share the BaseURLResolver, auth and metrics
+// of the HTTP proxy:
+//
+//   - the generic Invoker service from invoke.proto, which calls a function over HTTP
+//     and returns its status code, headers and body
+//   - native gRPC services implemented by a function, which are proxied to the function
+//     named in the "x-openfaas-function" metadata
+//
+// gRPC requires HTTP/2, so the provider's server must accept cleartext HTTP/2 (h2c) or TLS.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+// functionNameExpression matches the same names as the /function/{name} route.
+var functionNameExpression = regexp.MustCompile(`^[-a-zA-Z_0-9.]+$`)
+
+const (
+	// InvokePath is the path of the Invoke method of the Invoker service.
+	InvokePath = "/openfaas.provider.v1.Invoker/Invoke"
+
+	// FunctionMetadataKey names the function which implements a native gRPC service.
+	FunctionMetadataKey = "x-openfaas-function"
+
+	// defaultMaxMessageSize matches the default of the gRPC libraries.
+	defaultMaxMessageSize = 4 * 1024 * 1024
+
+	contentTypeGRPC = "application/grpc"
+)
+
+// gRPC status codes used by the Invoker service.
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codeNotFound          = 5
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+)
+
+// IsFunctionServiceRequest checks for a gRPC request to a native service implemented by a
+// function, named by the FunctionMetadataKey.
+func IsFunctionServiceRequest(r *http.Request) bool {
+	return httputil.IsGRPCRequest(r) && r.Header.Get(FunctionMetadataKey) != ""
+}
+
+// NewFunctionServiceHandler rewrites native gRPC requests to the /function/ route of the function
+// named in the FunctionMetadataKey and then serves them with router.
+func NewFunctionServiceHandler(router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functionName := r.Header.Get(FunctionMetadataKey)
+		if !validFunctionName(functionName) {
+			writeStatus(w, codeInvalidArgument, "invalid function name")
+			return
+		}
+
+		req := r.Clone(r.Context())
+		req.URL.Path = "/function/" + functionName + r.URL.Path
+		req.URL.RawPath = ""
+		req.Header.Del(FunctionMetadataKey)
+
+		router.ServeHTTP(w, req)
+	})
+}
+
+// validFunctionName checks the name against the characters allowed in the /function/ route,
+// so that a name such as "../system/functions" can not be rewritten into another route.
+func validFunctionName(name string) bool {
+	return functionNameExpression.MatchString(name) && strings.Trim(name, ".") != ""
+}
+
+// NewInvokeHandler serves the Invoke method of the Invoker service by making a request to the
+// /function/ route with router. maxMessageSize limits the size of the request message, with a
+// default of 4MB when it is zero.
+func NewInvokeHandler(router http.Handler, maxMessageSize int) http.Handler {
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultMaxMessageSize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !httputil.IsGRPCRequest(r) {
+			http.Error(w, "gRPC request required", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		message, err := readMessage(r.Body, maxMessageSize)
+		if err != nil {
+			var statusErr *statusError
+			if errors.As(err, &statusErr) {
+				writeStatus(w, statusErr.code, statusErr.message)
+				return
+			}
+			writeStatus(w, codeInternal, err.Error())
+			return
+		}
+
+		var functionReq FunctionRequest
+		if err := functionReq.Unmarshal(message); err != nil {
+			writeStatus(w, codeInternal, fmt.Sprintf("unable to decode FunctionRequest: %s", err))
+			return
+		}
+
+		if functionReq.Function == "" {
+			writeStatus(w, codeInvalidArgument, "function is required")
+			return
+		}
+
+		if !validFunctionName(functionReq.Function) || functionReq.Namespace != "" && !validFunctionName(functionReq.Namespace) {
+			writeStatus(w, codeInvalidArgument, "invalid function name")
+			return
+		}
+
+		ctx := r.Context()
+		if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		req, err := buildFunctionRequest(ctx, r, &functionReq)
+		if err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+
+		rw := httputil.NewBufferedResponseWriter()
+		router.ServeHTTP(rw, req)
+
+		// Errors from the proxy itself rather than the function are returned as gRPC errors.
+		if rw.Header().Get("X-OpenFaaS-Internal") != "" {
+			writeStatus(w, codeFromHTTPStatus(rw.Status()), strings.TrimSpace(string(rw.Body())))
+			return
+		}
+
+		res := FunctionResponse{
+			StatusCode: int32(rw.Status()),
+			Headers:    headersToMap(rw.Header()),
+			Body:       rw.Body(),
+		}
+
+		w.Header().Set("Content-Type", contentTypeGRPC)
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		writeMessage(w, res.Marshal())
+		w.Header().Set("Grpc-Status", strconv.Itoa(codeOK))
+	})
+}
+
+// buildFunctionRequest creates the HTTP request for the function's route from the message,
+// the authorization metadata is passed on so that the same auth applies as for HTTP.
+func buildFunctionRequest(ctx context.Context, r *http.Request, functionReq *FunctionRequest) (*http.Request, error) {
+	functionName := functionReq.Function
+	if functionReq.Namespace != "" {
+		functionName = functionName + "." + functionReq.Namespace
+	}
+
+	method := functionReq.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	u := url.URL{
+		Path:     "/function/" + functionName + "/" + strings.TrimPrefix(functionReq.Path, "/"),
+		RawQuery: functionReq.Query,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(functionReq.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range functionReq.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if auth := r.Header.Get("Authorization"); auth != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+
+	return req, nil
+}
+
+// statusError is a gRPC status which is returned to the client.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// readMessage reads a single length-prefixed message from a gRPC request body.
+func readMessage(r io.Reader, maxMessageSize int) ([]byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, &statusError{codeInternal, "unable to read message"}
+	}
+
+	if prefix[0] != 0 {
+		return nil, &statusError{codeUnimplemented, "compressed messages are not supported"}
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > uint32(maxMessageSize) {
+		return nil, &statusError{codeResourceExhausted, fmt.Sprintf("message larger than max (%d vs. %d)", size, maxMessageSize)}
+	}
+
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, &statusError{codeInternal, "unable to read message"}
+	}
+
+	return message, nil
+}
+
+// writeMessage writes a single uncompressed length-prefixed message.
+func writeMessage(w io.Writer, message []byte) error {
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err := w.Write(message)
+	return err
+}
+
+// writeStatus writes a trailers-only response with the gRPC status.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", contentTypeGRPC)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// codeFromHTTPStatus maps the status of an error from the proxy to a gRPC status code.
+func codeFromHTTPStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidArgument
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusRequestEntityTooLarge:
+		return codeResourceExhausted
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codeUnavailable
+	case http.StatusGatewayTimeout:
+		return codeDeadlineExceeded
+	default:
+		return codeInternal
+	}
+}
+
+// parseTimeout parses the grpc-timeout header, such as "100m" for 100 milliseconds.
+func parseTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	return time.Duration(amount) * unit, true
+}
@@ -0,0 +1,224 @@
+package grpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}/{params:.*}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars["name"] == "missing" {
+			w.Header().Set("X-OpenFaaS-Internal", "proxy")
+			http.Error(w, "No endpoints available for: missing.", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Function", vars["name"])
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s /%s?%s %s", r.Method, vars["name"], vars["params"], r.URL.RawQuery, body)
+	})
+
+	return router
+}
+
+func newGRPCRequest(path string, message []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writeMessage(body, message)
+
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", "application/grpc")
+	return req
+}
+
+func Test_FunctionRequest_RoundTrip(t *testing.T) {
+	want := FunctionRequest{
+		Function:  "echo",
+		Namespace: "openfaas-fn",
+		Method:    http.MethodPut,
+		Path:      "/items/1",
+		Query:     "verbose=true",
+		Headers:   map[string]string{"Content-Type": "text/plain", "X-Id": "1"},
+		Body:      []byte("hello"),
+	}
+
+	var got FunctionRequest
+	if err := got.Unmarshal(want.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Function != want.Function || got.Namespace != want.Namespace || got.Method != want.Method ||
+		got.Path != want.Path || got.Query != want.Query || string(got.Body) != string(want.Body) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	for k, v := range want.Headers {
+		if got.Headers[k] != v {
+			t.Errorf("want header %s: %q, got %q", k, v, got.Headers[k])
+		}
+	}
+}
+
+func Test_InvokeHandler(t *testing.T) {
+	handler := NewInvokeHandler(newTestRouter(), 0)
+
+	functionReq := FunctionRequest{
+		Function:  "echo",
+		Namespace: "openfaas-fn",
+		Path:      "/items/1",
+		Query:     "verbose=true",
+		Body:      []byte("hello"),
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCRequest(InvokePath, functionReq.Marshal()))
+
+	res := w.Result()
+	if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("want Grpc-Status 0, got %q", got)
+	}
+
+	message, err := readMessage(res.Body, defaultMaxMessageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var functionRes FunctionResponse
+	if err := functionRes.Unmarshal(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if functionRes.StatusCode != http.StatusCreated {
+		t.Errorf("want status code %d, got %d", http.StatusCreated, functionRes.StatusCode)
+	}
+
+	wantBody := "POST echo.openfaas-fn /items/1?verbose=true hello"
+	if string(functionRes.Body) != wantBody {
+		t.Errorf("want body %q, got %q", wantBody, string(functionRes.Body))
+	}
+
+	if got := functionRes.Headers["X-Function"]; got != "echo.openfaas-fn" {
+		t.Errorf("want X-Function header %q, got %q", "echo.openfaas-fn", got)
+	}
+}
+
+func Test_InvokeHandler_Errors(t *testing.T) {
+	cases := []struct {
+		name     string
+		request  FunctionRequest
+		wantCode int
+	}{
+		{
+			name:     "missing function name",
+			request:  FunctionRequest{},
+			wantCode: codeInvalidArgument,
+		},
+		{
+			name:     "function name with a path",
+			request:  FunctionRequest{Function: "../system/functions"},
+			wantCode: codeInvalidArgument,
+		},
+		{
+			name:     "namespace with a path",
+			request:  FunctionRequest{Function: "echo", Namespace: "../../system"},
+			wantCode: codeInvalidArgument,
+		},
+		{
+			name:     "proxy error",
+			request:  FunctionRequest{Function: "missing"},
+			wantCode: codeUnavailable,
+		},
+	}
+
+	handler := NewInvokeHandler(newTestRouter(), 0)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newGRPCRequest(InvokePath, tc.request.Marshal()))
+
+			got := w.Header().Get("Grpc-Status")
+			if got != strconv.Itoa(tc.wantCode) {
+				t.Errorf("want Grpc-Status %d, got %q", tc.wantCode, got)
+			}
+		})
+	}
+}
+
+func Test_InvokeHandler_MessageTooLarge(t *testing.T) {
+	handler := NewInvokeHandler(newTestRouter(), 8)
+
+	functionReq := FunctionRequest{Function: "echo", Body: []byte("hello world")}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCRequest(InvokePath, functionReq.Marshal()))
+
+	if got := w.Header().Get("Grpc-Status"); got != strconv.Itoa(codeResourceExhausted) {
+		t.Errorf("want Grpc-Status %d, got %q", codeResourceExhausted, got)
+	}
+}
+
+func Test_FunctionServiceHandler(t *testing.T) {
+	handler := NewFunctionServiceHandler(newTestRouter())
+
+	req := newGRPCRequest("/helloworld.Greeter/SayHello", []byte("hello"))
+	req.Header.Set(FunctionMetadataKey, "greeter")
+
+	if !IsFunctionServiceRequest(req) {
+		t.Fatalf("want request to be for a function service")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Function"); got != "greeter" {
+		t.Errorf("want request to be routed to greeter, got %q", got)
+	}
+}
+
+func Test_FunctionServiceHandler_InvalidName(t *testing.T) {
+	handler := NewFunctionServiceHandler(newTestRouter())
+
+	for _, name := range []string{"../system/functions", "..", "greeter/x"} {
+		t.Run(name, func(t *testing.T) {
+			req := newGRPCRequest("/helloworld.Greeter/SayHello", []byte("hello"))
+			req.Header.Set(FunctionMetadataKey, name)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Grpc-Status"); got != strconv.Itoa(codeInvalidArgument) {
+				t.Errorf("want Grpc-Status %d, got %q", codeInvalidArgument, got)
+			}
+			if got := w.Header().Get("X-Function"); got != "" {
+				t.Errorf("want request not to be routed, got %q", got)
+			}
+		})
+	}
+}
+
+func Test_parseTimeout(t *testing.T) {
+	cases := map[string]bool{
+		"100m": true,
+		"1S":   true,
+		"5":    false,
+		"10x":  false,
+		"":     false,
+	}
+
+	for value, wantOK := range cases {
+		if _, ok := parseTimeout(value); ok != wantOK {
+			t.Errorf("parseTimeout(%q) want ok: %t, got %t", value, wantOK, ok)
+		}
+	}
+}
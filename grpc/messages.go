@@ -0,0 +1,211 @@
+package grpc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// FunctionRequest is the request message of the Invoker service, see invoke.proto.
+type FunctionRequest struct {
+	Function  string
+	Namespace string
+	Method    string
+	Path      string
+	Query     string
+	Headers   map[string]string
+	Body      []byte
+}
+
+// FunctionResponse is the response message of the Invoker service, see invoke.proto.
+type FunctionResponse struct {
+	StatusCode int32
+	Headers    map[string]string
+	Body       []byte
+}
+
+// Marshal encodes the request in the protobuf wire format.
+func (m *FunctionRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Function)
+	b = appendString(b, 2, m.Namespace)
+	b = appendString(b, 3, m.Method)
+	b = appendString(b, 4, m.Path)
+	b = appendString(b, 5, m.Query)
+	b = appendMap(b, 6, m.Headers)
+	b = appendBytes(b, 7, m.Body)
+	return b
+}
+
+// Unmarshal decodes the request from the protobuf wire format.
+func (m *FunctionRequest) Unmarshal(b []byte) error {
+	return parseFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			m.Function = string(value)
+		case 2:
+			m.Namespace = string(value)
+		case 3:
+			m.Method = string(value)
+		case 4:
+			m.Path = string(value)
+		case 5:
+			m.Query = string(value)
+		case 6:
+			if m.Headers == nil {
+				m.Headers = map[string]string{}
+			}
+			return parseMapEntry(value, m.Headers)
+		case 7:
+			m.Body = append([]byte(nil), value...)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the response in the protobuf wire format.
+func (m *FunctionResponse) Marshal() []byte {
+	var b []byte
+	if m.StatusCode != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.StatusCode))
+	}
+	b = appendMap(b, 2, m.Headers)
+	b = appendBytes(b, 3, m.Body)
+	return b
+}
+
+// Unmarshal decodes the response from the protobuf wire format.
+func (m *FunctionResponse) Unmarshal(b []byte) error {
+	return parseFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(value)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			m.StatusCode = int32(v)
+		case num == 2 && typ == protowire.BytesType:
+			if m.Headers == nil {
+				m.Headers = map[string]string{}
+			}
+			return parseMapEntry(value, m.Headers)
+		case num == 3 && typ == protowire.BytesType:
+			m.Body = append([]byte(nil), value...)
+		}
+		return nil
+	})
+}
+
+// headersToMap joins multiple header values with ", " as there is one value per key in the message.
+func headersToMap(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(header))
+	for k, v := range header {
+		values[k] = strings.Join(v, ", ")
+	}
+	return values
+}
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendBytes(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// appendMap encodes a map<string, string> field as repeated entries, sorted
+// by key so that the encoding is deterministic.
+func appendMap(b []byte, num protowire.Number, values map[string]string) []byte {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, values[k])
+
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// parseFields calls fn with each field in b. For length-delimited fields value is
+// the content of the field, for varints value holds the encoded varint.
+func parseFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("invalid tag: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(b)
+			if m < 0 {
+				return fmt.Errorf("invalid field %d: %w", num, protowire.ParseError(m))
+			}
+			value, n = v, m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return fmt.Errorf("invalid field %d: %w", num, protowire.ParseError(n))
+			}
+			value = b[:n]
+		}
+
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+func parseMapEntry(b []byte, values map[string]string) error {
+	var key, value string
+	err := parseFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			value = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	values[key] = value
+	return nil
+}
@@ -0,0 +1,303 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/accesslog"
+	"github.com/openfaas/faas-provider/auth"
+	"github.com/openfaas/faas-provider/grpc"
+	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/queue"
+	"github.com/openfaas/faas-provider/revisions"
+	"github.com/openfaas/faas-provider/tracing"
+	"github.com/openfaas/faas-provider/types"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Routes selects the groups of routes registered by NewHandler.
+type Routes int
+
+const (
+	// InvocationRoutes are the /function/, /async-function/ and /webhook/ routes and gRPC.
+	InvocationRoutes Routes = 1 << iota
+	// AdminRoutes are the /system/ routes.
+	AdminRoutes
+	// MetricsRoutes are the /metrics and /healthz routes.
+	MetricsRoutes
+
+	// AllRoutes is the default for NewHandler.
+	AllRoutes = InvocationRoutes | AdminRoutes | MetricsRoutes
+)
+
+// Option configures the handler created by NewHandler.
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	router     *mux.Router
+	pathPrefix string
+	routes     Routes
+}
+
+// WithRouter registers the provider's routes on router, so that the API can be served
+// alongside other routes. The middleware is added to router when there is no path prefix.
+func WithRouter(router *mux.Router) Option {
+	return func(o *handlerOptions) {
+		o.router = router
+	}
+}
+
+// WithPathPrefix serves the provider's routes below prefix, such as "/provider/v1", with the
+// middleware added to the prefix only. The gRPC routes are not prefixed, since their paths
+// are set by the gRPC protocol.
+func WithPathPrefix(prefix string) Option {
+	return func(o *handlerOptions) {
+		o.pathPrefix = "/" + strings.Trim(prefix, "/")
+		if o.pathPrefix == "/" {
+			o.pathPrefix = ""
+		}
+	}
+}
+
+// WithRoutes registers only the given groups of routes, so that they can be served on
+// separate listeners.
+func WithRoutes(routes Routes) Option {
+	return func(o *handlerOptions) {
+		o.routes = routes
+	}
+}
+
+// NewHandler creates an http.Handler for your handlers with the OpenFaaS route spec. Unlike
+// Serve, the handlers are not modified, and a new router is used unless WithRouter is given,
+// so that several instances can be created in one process.
+//
+// Tracing is not set up by NewHandler, call exporter.Setup when config.TracingExporter is set.
+func NewHandler(handlers *types.FaaSHandlers, config *types.FaaSConfig, opts ...Option) (http.Handler, error) {
+	o := handlerOptions{
+		routes: AllRoutes,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.router == nil {
+		o.router = mux.NewRouter()
+	}
+
+	logger := config.GetLogger()
+
+	// Copy the handlers, so that they are not decorated twice when used by more than one
+	// instance.
+	h := *handlers
+
+	var listRevisions, rollbackFunction http.HandlerFunc
+	if h.RevisionStore != nil {
+		h.DeployFunction = revisions.Record(h.DeployFunction, h.RevisionStore, revisions.OperationDeploy, logger)
+		h.UpdateFunction = revisions.Record(h.UpdateFunction, h.RevisionStore, revisions.OperationUpdate, logger)
+
+		listRevisions = revisions.NewListHandlerFunc(h.RevisionStore)
+		rollbackFunction = revisions.NewRollbackHandlerFunc(h.RevisionStore, h.UpdateFunction)
+	}
+
+	if config.EnableBasicAuth && o.routes&AdminRoutes != 0 {
+		reader := auth.ReadBasicAuthFromDisk{
+			SecretMountPath: config.SecretMountPath,
+		}
+
+		credentials, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read basic auth credentials: %w", err)
+		}
+
+		h.FunctionLister = auth.DecorateWithBasicAuth(h.FunctionLister, credentials)
+		h.DeployFunction = auth.DecorateWithBasicAuth(h.DeployFunction, credentials)
+		h.DeleteFunction = auth.DecorateWithBasicAuth(h.DeleteFunction, credentials)
+		h.UpdateFunction = auth.DecorateWithBasicAuth(h.UpdateFunction, credentials)
+		h.FunctionStatus = auth.DecorateWithBasicAuth(h.FunctionStatus, credentials)
+		h.ScaleFunction = auth.DecorateWithBasicAuth(h.ScaleFunction, credentials)
+		h.Info = auth.DecorateWithBasicAuth(h.Info, credentials)
+		h.Secrets = auth.DecorateWithBasicAuth(h.Secrets, credentials)
+		h.Logs = auth.DecorateWithBasicAuth(h.Logs, credentials)
+
+		if h.Telemetry != nil {
+			h.Telemetry = auth.DecorateWithBasicAuth(h.Telemetry, credentials)
+		}
+
+		if h.AsyncStatus != nil {
+			h.AsyncStatus = auth.DecorateWithBasicAuth(h.AsyncStatus, credentials)
+		}
+
+		if h.Traffic != nil {
+			h.Traffic = auth.DecorateWithBasicAuth(h.Traffic, credentials)
+		}
+
+		if h.RevisionStore != nil {
+			listRevisions = auth.DecorateWithBasicAuth(listRevisions, credentials)
+			rollbackFunction = auth.DecorateWithBasicAuth(rollbackFunction, credentials)
+		}
+	}
+
+	hm := sharedHttpMetrics()
+
+	// gRPC invocations are served through the /function/ routes below, so must be matched first
+	if config.EnableGRPC && o.routes&InvocationRoutes != 0 {
+		functionRouter := withPathPrefix(o.pathPrefix, o.router)
+
+		o.router.Handle(grpc.InvokePath,
+			hm.InstrumentHandler(grpc.NewInvokeHandler(functionRouter, int(config.MaxRequestBodySize)), "")).Methods(http.MethodPost)
+
+		o.router.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+			return grpc.IsFunctionServiceRequest(req)
+		}).Handler(grpc.NewFunctionServiceHandler(functionRouter))
+	}
+
+	r := o.router
+	if o.pathPrefix != "" {
+		r = o.router.PathPrefix(o.pathPrefix).Subrouter()
+	}
+
+	// The call ID is assigned first, so that it is available to the tracing middleware.
+	r.Use(fhttputil.CallIDMiddleware)
+
+	if config.AccessLogFormat != "" {
+		accessLogConfig := accesslog.ConfigFromFaaSConfig(*config)
+		accessLogConfig.PathPrefix = o.pathPrefix
+
+		accessLog, err := accesslog.New(accessLogConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up the access log: %w", err)
+		}
+
+		r.Use(accessLog)
+	}
+
+	if config.TracingExporter != "" {
+		r.Use(tracing.Middleware)
+	}
+
+	if o.routes&AdminRoutes != 0 {
+		registerAdminRoutes(r, &h, hm, listRevisions, rollbackFunction)
+	}
+
+	if o.routes&InvocationRoutes != 0 {
+		registerInvocationRoutes(r, &h, hm, config)
+	}
+
+	if o.routes&MetricsRoutes != 0 {
+		if h.Health != nil {
+			r.HandleFunc("/healthz", h.Health).
+				Methods(http.MethodGet, http.MethodHead)
+		}
+
+		r.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
+	}
+
+	var handler http.Handler = o.router
+	if config.EnableGRPC && o.routes&InvocationRoutes != 0 {
+		handler = h2c.NewHandler(o.router, &http2.Server{})
+	}
+
+	return handler, nil
+}
+
+// registerAdminRoutes registers the /system/ routes.
+func registerAdminRoutes(r *mux.Router, h *types.FaaSHandlers, hm *httpMetrics, listRevisions, rollbackFunction http.HandlerFunc) {
+	// System (auth) endpoints
+	r.HandleFunc("/system/functions", hm.InstrumentHandler(h.FunctionLister, "")).Methods(http.MethodGet)
+	r.HandleFunc("/system/functions", hm.InstrumentHandler(h.DeployFunction, "")).Methods(http.MethodPost)
+	r.HandleFunc("/system/functions", hm.InstrumentHandler(h.DeleteFunction, "")).Methods(http.MethodDelete)
+	r.HandleFunc("/system/functions", hm.InstrumentHandler(h.UpdateFunction, "")).Methods(http.MethodPut)
+
+	r.HandleFunc("/system/function/{name:["+NameExpression+"]+}",
+		hm.InstrumentHandler(h.FunctionStatus, "/system/function")).Methods(http.MethodGet)
+	r.HandleFunc("/system/scale-function/{name:["+NameExpression+"]+}",
+		hm.InstrumentHandler(h.ScaleFunction, "/system/scale-function")).Methods(http.MethodPost)
+
+	if h.RevisionStore != nil {
+		r.HandleFunc("/system/function/{name:["+NameExpression+"]+}/revisions",
+			hm.InstrumentHandler(listRevisions, "/system/function/revisions")).Methods(http.MethodGet)
+		r.HandleFunc("/system/function/{name:["+NameExpression+"]+}/rollback",
+			hm.InstrumentHandler(rollbackFunction, "/system/function/rollback")).Methods(http.MethodPost)
+	}
+
+	r.HandleFunc("/system/info",
+		hm.InstrumentHandler(h.Info, "")).Methods(http.MethodGet)
+
+	r.HandleFunc("/system/secrets",
+		hm.InstrumentHandler(h.Secrets, "")).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+
+	r.HandleFunc("/system/logs",
+		hm.InstrumentHandler(h.Logs, "")).Methods(http.MethodGet)
+
+	r.HandleFunc("/system/namespaces", hm.InstrumentHandler(h.ListNamespaces, "")).Methods(http.MethodGet)
+
+	// Only register the mutate namespace handler if it is defined
+	if h.MutateNamespace != nil {
+		r.HandleFunc("/system/namespace/{name:["+NameExpression+"]*}",
+			hm.InstrumentHandler(h.MutateNamespace, "")).Methods(http.MethodPost, http.MethodDelete, http.MethodPut, http.MethodGet)
+	} else {
+		r.HandleFunc("/system/namespace/{name:["+NameExpression+"]*}",
+			hm.InstrumentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Feature not implemented in this version of OpenFaaS", http.StatusNotImplemented)
+			}), "")).Methods(http.MethodGet)
+	}
+
+	if h.AsyncStatus != nil {
+		r.HandleFunc("/system/async/{callId}",
+			hm.InstrumentHandler(h.AsyncStatus, "/system/async")).Methods(http.MethodGet)
+	}
+
+	if h.Traffic != nil {
+		r.HandleFunc("/system/traffic",
+			hm.InstrumentHandler(h.Traffic, "")).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+	}
+
+	if h.Telemetry != nil {
+		r.HandleFunc("/system/telemetry", hm.InstrumentHandler(h.Telemetry, "")).Methods(http.MethodGet)
+	}
+}
+
+// registerInvocationRoutes registers the /function/, /async-function/ and /webhook/ routes.
+func registerInvocationRoutes(r *mux.Router, h *types.FaaSHandlers, hm *httpMetrics, config *types.FaaSConfig) {
+	proxyHandler := h.FunctionProxy
+
+	// Open endpoints
+	r.HandleFunc("/function/{name:["+NameExpression+"]+}", proxyHandler)
+	r.HandleFunc("/function/{name:["+NameExpression+"]+}/", proxyHandler)
+	r.HandleFunc("/function/{name:["+NameExpression+"]+}/{params:.*}", proxyHandler)
+
+	if h.RequestQueuer != nil {
+		asyncHandler := hm.InstrumentHandler(queue.NewHandlerFunc(*config, h.RequestQueuer), "/async-function")
+
+		r.HandleFunc("/async-function/{name:["+NameExpression+"]+}", asyncHandler)
+		r.HandleFunc("/async-function/{name:["+NameExpression+"]+}/", asyncHandler)
+		r.HandleFunc("/async-function/{name:["+NameExpression+"]+}/{params:.*}", asyncHandler)
+	}
+
+	if h.Webhook != nil {
+		webhookHandler := hm.InstrumentHandler(h.Webhook, "/webhook")
+
+		r.HandleFunc("/webhook/{name:["+NameExpression+"]+}", webhookHandler)
+		r.HandleFunc("/webhook/{name:["+NameExpression+"]+}/", webhookHandler)
+		r.HandleFunc("/webhook/{name:["+NameExpression+"]+}/{params:.*}", webhookHandler)
+	}
+}
+
+// withPathPrefix adds prefix to the path of requests before serving them with next, for the
+// gRPC handlers which rewrite requests to the unprefixed /function/ route.
+func withPathPrefix(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = prefix + r.URL.Path
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
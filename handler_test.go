@@ -0,0 +1,136 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas-provider/webhook"
+)
+
+func newTestHandlers(name string) *types.FaaSHandlers {
+	respond := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}
+
+	return &types.FaaSHandlers{
+		FunctionProxy:  respond,
+		FunctionLister: respond,
+		DeployFunction: respond,
+		DeleteFunction: respond,
+		UpdateFunction: respond,
+		FunctionStatus: respond,
+		ScaleFunction:  respond,
+		Secrets:        respond,
+		Logs:           respond,
+		Info:           respond,
+		ListNamespaces: respond,
+		Health:         respond,
+	}
+}
+
+func Test_NewHandler_Routes(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   []Option
+		path   string
+		status int
+	}{
+		{name: "function", path: "/function/env", status: http.StatusOK},
+		{name: "system", path: "/system/functions", status: http.StatusOK},
+		{name: "prefixed function", opts: []Option{WithPathPrefix("/provider/v1")}, path: "/provider/v1/function/env", status: http.StatusOK},
+		{name: "prefixed system", opts: []Option{WithPathPrefix("provider/v1/")}, path: "/provider/v1/system/info", status: http.StatusOK},
+		{name: "unprefixed path with prefix", opts: []Option{WithPathPrefix("/provider/v1")}, path: "/system/info", status: http.StatusNotFound},
+		{name: "root prefix", opts: []Option{WithPathPrefix("/")}, path: "/system/info", status: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler, err := NewHandler(newTestHandlers(tc.name), &types.FaaSConfig{}, tc.opts...)
+			if err != nil {
+				t.Fatalf("want no error, got: %s", err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rr.Code != tc.status {
+				t.Fatalf("want status %d, got %d", tc.status, rr.Code)
+			}
+			if tc.status == http.StatusOK && rr.Body.String() != tc.name {
+				t.Errorf("want body %q, got %q", tc.name, rr.Body.String())
+			}
+		})
+	}
+}
+
+func Test_NewHandler_WithRouter(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/ui", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ui"))
+	})
+
+	handler, err := NewHandler(newTestHandlers("provider"), &types.FaaSConfig{}, WithRouter(router), WithPathPrefix("/provider"))
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	for path, want := range map[string]string{"/ui": "ui", "/provider/function/env": "provider"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rr.Body.String() != want {
+			t.Errorf("want body %q for %s, got %q", want, path, rr.Body.String())
+		}
+	}
+}
+
+func Test_NewHandler_BasicAuthError(t *testing.T) {
+	handlers := newTestHandlers("provider")
+	config := &types.FaaSConfig{
+		EnableBasicAuth: true,
+		SecretMountPath: t.TempDir(),
+	}
+
+	if _, err := NewHandler(handlers, config); err == nil {
+		t.Fatalf("want error for missing credentials, got nil")
+	}
+}
+
+func Test_NewHandler_GenericWebhook(t *testing.T) {
+	secrets := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secrets, "webhook-secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := webhook.ResolverFunc(func(functionName string) (*webhook.Config, error) {
+		return &webhook.Config{Provider: webhook.ProviderGeneric, Secret: "webhook-secret"}, nil
+	})
+
+	handlers := newTestHandlers("webhook")
+	handlers.Webhook = webhook.NewHandlerFunc(types.FaaSConfig{SecretMountPath: secrets}, resolver, handlers.FunctionProxy)
+
+	handler, err := NewHandler(handlers, &types.FaaSConfig{}, WithRoutes(InvocationRoutes))
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	body := `{"event":"created"}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook/env", strings.NewReader(body))
+	webhook.SetGenericSignature(req.Header, []byte("secret"), time.Now(), []byte(body))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "webhook" {
+		t.Errorf("want the webhook to be forwarded, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,57 @@
+package httputil
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// BufferedResponseWriter collects a response in memory, it is used to invoke
+// functions through a http.Handler when the result is needed as a whole, such
+// as for asynchronous invocations.
+type BufferedResponseWriter struct {
+	header      http.Header
+	body        bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+}
+
+// NewBufferedResponseWriter creates an empty BufferedResponseWriter.
+func NewBufferedResponseWriter() *BufferedResponseWriter {
+	return &BufferedResponseWriter{
+		header:     http.Header{},
+		statusCode: http.StatusOK,
+	}
+}
+
+func (w *BufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *BufferedResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(data)
+}
+
+func (w *BufferedResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.statusCode = code
+	w.wroteHeader = true
+}
+
+// Flush is a no-op as the response is only read once it is complete.
+func (w *BufferedResponseWriter) Flush() {
+}
+
+// Status returns the status code written, or 200 when no status was written.
+func (w *BufferedResponseWriter) Status() int {
+	return w.statusCode
+}
+
+// Body returns the bytes written to the response.
+func (w *BufferedResponseWriter) Body() []byte {
+	return w.body.Bytes()
+}
@@ -0,0 +1,122 @@
+package httputil
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// CallIDHeader identifies a system call or invocation across the gateway, the provider
+	// and the function.
+	CallIDHeader = "X-Call-Id"
+
+	// RequestIDHeader is accepted in place of the CallIDHeader, and set to the same value.
+	RequestIDHeader = "X-Request-Id"
+
+	// maxCallIDLength limits the size of call IDs accepted from callers.
+	maxCallIDLength = 128
+)
+
+// callIDKey is the context key for the call ID.
+type callIDKey struct{}
+
+// callerCallIDKey is the context key for the call ID given by the caller.
+type callerCallIDKey struct{}
+
+// NewCallID creates a random version 4 UUID.
+func NewCallID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// WithCallID returns a copy of ctx which carries the call ID.
+func WithCallID(ctx context.Context, callID string) context.Context {
+	return context.WithValue(ctx, callIDKey{}, callID)
+}
+
+// CallID returns the call ID of a request from its context, or from the CallIDHeader or
+// RequestIDHeader when the request did not pass through CallIDMiddleware. An empty string
+// is returned when there is no call ID.
+func CallID(r *http.Request) string {
+	if callID, ok := r.Context().Value(callIDKey{}).(string); ok {
+		return callID
+	}
+
+	if callID := r.Header.Get(CallIDHeader); validCallID(callID) {
+		return callID
+	}
+
+	if callID := r.Header.Get(RequestIDHeader); validCallID(callID) {
+		return callID
+	}
+
+	return ""
+}
+
+// CallerCallID returns the call ID given by the caller in the CallIDHeader or
+// RequestIDHeader, or an empty string when the call ID was created by CallIDMiddleware
+// or there is none.
+func CallerCallID(r *http.Request) string {
+	if callID, ok := r.Context().Value(callerCallIDKey{}).(string); ok {
+		return callID
+	}
+
+	if _, ok := r.Context().Value(callIDKey{}).(string); ok {
+		return ""
+	}
+
+	return CallID(r)
+}
+
+// CallIDMiddleware is a mux.MiddlewareFunc which accepts the caller's CallIDHeader or
+// RequestIDHeader, or creates a new call ID. The call ID is set in both headers of the
+// request and the response, and in the request context.
+func CallIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		callID := CallID(r)
+		if callID == "" {
+			var err error
+			if callID, err = NewCallID(); err != nil {
+				Errorf(w, http.StatusInternalServerError, "Unable to create call ID: %s", err)
+				return
+			}
+		} else {
+			ctx = context.WithValue(ctx, callerCallIDKey{}, callID)
+		}
+
+		r.Header.Set(CallIDHeader, callID)
+		r.Header.Set(RequestIDHeader, callID)
+
+		w.Header().Set(CallIDHeader, callID)
+		w.Header().Set(RequestIDHeader, callID)
+
+		next.ServeHTTP(w, r.WithContext(WithCallID(ctx, callID)))
+	})
+}
+
+// validCallID accepts printable ASCII call IDs up to maxCallIDLength, so that a caller can
+// not inject arbitrary content into logs and headers.
+func validCallID(callID string) bool {
+	if callID == "" || len(callID) > maxCallIDLength {
+		return false
+	}
+
+	for i := 0; i < len(callID); i++ {
+		if callID[i] <= ' ' || callID[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
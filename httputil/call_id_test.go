@@ -0,0 +1,63 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func Test_CallIDMiddleware(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  http.Header
+		want    string
+		wantNew bool
+	}{
+		{name: "new call ID", header: http.Header{}, wantNew: true},
+		{name: "call ID", header: http.Header{CallIDHeader: []string{"call-1"}}, want: "call-1"},
+		{name: "request ID", header: http.Header{RequestIDHeader: []string{"request-1"}}, want: "request-1"},
+		{name: "call ID preferred", header: http.Header{CallIDHeader: []string{"call-1"}, RequestIDHeader: []string{"request-1"}}, want: "call-1"},
+		{name: "invalid call ID", header: http.Header{CallIDHeader: []string{"call 1\n"}}, wantNew: true},
+		{name: "long call ID", header: http.Header{CallIDHeader: []string{strings.Repeat("a", 200)}}, wantNew: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotContext, gotHeader, gotCaller string
+			handler := CallIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotContext = CallID(r)
+				gotHeader = r.Header.Get(CallIDHeader)
+				gotCaller = CallerCallID(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://gateway/system/functions", nil)
+			req.Header = tc.header
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			callID := w.Header().Get(CallIDHeader)
+			if tc.wantNew {
+				if !uuidPattern.MatchString(callID) {
+					t.Errorf("want a new UUID, got %q", callID)
+				}
+			} else if callID != tc.want {
+				t.Errorf("want %q, got %q", tc.want, callID)
+			}
+
+			if w.Header().Get(RequestIDHeader) != callID {
+				t.Errorf("want %s to match, got %q", RequestIDHeader, w.Header().Get(RequestIDHeader))
+			}
+			if gotContext != callID || gotHeader != callID {
+				t.Errorf("want the call ID in the request, got %q in the context and %q in the header", gotContext, gotHeader)
+			}
+			if gotCaller != tc.want {
+				t.Errorf("want caller call ID %q, got %q", tc.want, gotCaller)
+			}
+		})
+	}
+}
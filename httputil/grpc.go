@@ -0,0 +1,20 @@
+package httputil
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsGRPCRequest checks for a HTTP/2 request with the Content-Type application/grpc
+// or one of its variants such as application/grpc+proto. gRPC-Web is not included as
+// it does not require HTTP/2.
+func IsGRPCRequest(r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
+	}
+
+	contentType := strings.ToLower(r.Header.Get("Content-Type"))
+	return contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
@@ -0,0 +1,34 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_IsGRPCRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		protoMajor  int
+		contentType string
+		want        bool
+	}{
+		{name: "gRPC", protoMajor: 2, contentType: "application/grpc", want: true},
+		{name: "gRPC with codec", protoMajor: 2, contentType: "application/grpc+proto", want: true},
+		{name: "gRPC-Web", protoMajor: 2, contentType: "application/grpc-web", want: false},
+		{name: "HTTP/1.1", protoMajor: 1, contentType: "application/grpc", want: false},
+		{name: "JSON", protoMajor: 2, contentType: "application/json", want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.ProtoMajor = tc.protoMajor
+			req.Header.Set("Content-Type", tc.contentType)
+
+			if got := IsGRPCRequest(req); got != tc.want {
+				t.Errorf("want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
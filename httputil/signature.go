@@ -0,0 +1,126 @@
+package httputil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 signature of a request, in the form "sha256=<hex>".
+	SignatureHeader = "X-OpenFaaS-Signature"
+
+	// SignatureTimestampHeader holds the Unix time in seconds at which the request was signed,
+	// it is part of the signed payload so that it cannot be changed to replay a request.
+	SignatureTimestampHeader = "X-OpenFaaS-Signature-Timestamp"
+
+	// FunctionStatusHeader holds the HTTP status returned by the function in a callback, it
+	// is part of the signed payload along with the CallIDHeader.
+	FunctionStatusHeader = "X-Function-Status"
+
+	signaturePrefix = "sha256="
+
+	// DefaultSignatureTolerance is the maximum age of a signature accepted by VerifyRequest.
+	DefaultSignatureTolerance = 5 * time.Minute
+)
+
+var (
+	// ErrSignatureMissing is returned when the request has no signature or timestamp.
+	ErrSignatureMissing = errors.New("signature or timestamp missing")
+
+	// ErrSignatureInvalid is returned when the signature does not match the payload.
+	ErrSignatureInvalid = errors.New("signature is invalid")
+
+	// ErrSignatureExpired is returned when the timestamp is outside of the tolerance.
+	ErrSignatureExpired = errors.New("signature timestamp is outside of the tolerance")
+)
+
+// Sign returns the HMAC-SHA256 signature of a request with the secret. The signed payload
+// is the timestamp in Unix seconds, the call ID, the function status and the body, joined
+// by a ".":
+//
+//	<timestamp>.<X-Call-Id>.<X-Function-Status>.<body>
+//
+// An empty call ID or status is signed as an empty string.
+func Sign(secret []byte, timestamp time.Time, callID, status string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(callID))
+	mac.Write([]byte("."))
+	mac.Write([]byte(status))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetSignature signs the body with the CallIDHeader and FunctionStatusHeader of the header,
+// and sets the SignatureHeader and SignatureTimestampHeader. It must be called after the
+// CallIDHeader and FunctionStatusHeader have been set.
+func SetSignature(header http.Header, secret []byte, timestamp time.Time, body []byte) {
+	header.Set(SignatureTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set(SignatureHeader, Sign(secret, timestamp, header.Get(CallIDHeader), header.Get(FunctionStatusHeader), body))
+}
+
+// VerifySignature checks the signature headers against the body, the CallIDHeader and the
+// FunctionStatusHeader, see Sign for the signed payload. Signatures with a timestamp more
+// than tolerance from now are rejected with ErrSignatureExpired.
+func VerifySignature(header http.Header, body []byte, secret []byte, tolerance time.Duration, now time.Time) error {
+	signature := header.Get(SignatureHeader)
+	timestampValue := header.Get(SignatureTimestampHeader)
+	if signature == "" || timestampValue == "" {
+		return ErrSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestampValue, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	timestamp := time.Unix(seconds, 0)
+
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrSignatureInvalid
+	}
+
+	want := Sign(secret, timestamp, header.Get(CallIDHeader), header.Get(FunctionStatusHeader), body)
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return ErrSignatureInvalid
+	}
+
+	if age := now.Sub(timestamp); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// VerifyRequest reads the body of a signed request, such as a callback for an asynchronous
+// invocation, and checks its signature over the body, call ID and status with
+// DefaultSignatureTolerance. The body is returned, and is also replaced so that it can be
+// read again from r.Body.
+func VerifyRequest(r *http.Request, secret []byte) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := VerifySignature(r.Header, body, secret, DefaultSignatureTolerance, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
@@ -0,0 +1,163 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_VerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"status":"done"}`)
+	signed := time.Unix(1700000000, 0)
+
+	signedHeader := func() http.Header {
+		h := http.Header{}
+		h.Set(CallIDHeader, "call-1")
+		h.Set(FunctionStatusHeader, "200")
+		SetSignature(h, secret, signed, body)
+		return h
+	}
+
+	cases := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{
+			name:   "valid",
+			header: signedHeader,
+			body:   body,
+			now:    signed.Add(time.Minute),
+			want:   nil,
+		},
+		{
+			name:   "missing",
+			header: func() http.Header { return http.Header{} },
+			body:   body,
+			now:    signed,
+			want:   ErrSignatureMissing,
+		},
+		{
+			name: "modified body",
+			header: func() http.Header {
+				h := http.Header{}
+				SetSignature(h, secret, signed, body)
+				return h
+			},
+			body: []byte(`{"status":"failed"}`),
+			now:  signed,
+			want: ErrSignatureInvalid,
+		},
+		{
+			name: "modified call ID",
+			header: func() http.Header {
+				h := signedHeader()
+				h.Set(CallIDHeader, "call-2")
+				return h
+			},
+			body: body,
+			now:  signed,
+			want: ErrSignatureInvalid,
+		},
+		{
+			name: "modified status",
+			header: func() http.Header {
+				h := signedHeader()
+				h.Set(FunctionStatusHeader, "500")
+				return h
+			},
+			body: body,
+			now:  signed,
+			want: ErrSignatureInvalid,
+		},
+		{
+			name: "wrong secret",
+			header: func() http.Header {
+				h := http.Header{}
+				SetSignature(h, []byte("other"), signed, body)
+				return h
+			},
+			body: body,
+			now:  signed,
+			want: ErrSignatureInvalid,
+		},
+		{
+			name: "replayed timestamp",
+			header: func() http.Header {
+				h := http.Header{}
+				SetSignature(h, secret, signed, body)
+				h.Set(SignatureTimestampHeader, "1700000600")
+				return h
+			},
+			body: body,
+			now:  signed.Add(10 * time.Minute),
+			want: ErrSignatureInvalid,
+		},
+		{
+			name: "expired",
+			header: func() http.Header {
+				h := http.Header{}
+				SetSignature(h, secret, signed, body)
+				return h
+			},
+			body: body,
+			now:  signed.Add(10 * time.Minute),
+			want: ErrSignatureExpired,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := VerifySignature(tc.header(), tc.body, secret, DefaultSignatureTolerance, tc.now)
+			if got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_VerifyRequest(t *testing.T) {
+	secret := []byte("secret")
+	body := "hello"
+
+	req := httptest.NewRequest(http.MethodPost, "http://receiver/callback", strings.NewReader(body))
+	req.Header.Set(CallIDHeader, "call-1")
+	req.Header.Set(FunctionStatusHeader, "200")
+	SetSignature(req.Header, secret, time.Now(), []byte(body))
+
+	got, err := VerifyRequest(req, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(got) != body {
+		t.Errorf("want body %q, got %q", body, got)
+	}
+
+	again, _ := io.ReadAll(req.Body)
+	if string(again) != body {
+		t.Errorf("want body to be readable again, got %q", again)
+	}
+}
+
+func Test_VerifyRequest_ModifiedStatus(t *testing.T) {
+	secret := []byte("secret")
+	body := "hello"
+
+	req := httptest.NewRequest(http.MethodPost, "http://receiver/callback", strings.NewReader(body))
+	req.Header.Set(CallIDHeader, "call-1")
+	req.Header.Set(FunctionStatusHeader, "500")
+	SetSignature(req.Header, secret, time.Now(), []byte(body))
+
+	req.Header.Set(FunctionStatusHeader, "200")
+
+	if _, err := VerifyRequest(req, secret); err != ErrSignatureInvalid {
+		t.Errorf("want %v, got %v", ErrSignatureInvalid, err)
+	}
+}
@@ -0,0 +1,152 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// listen creates the listener for the API from the config's Listener, systemd socket,
+// UnixSocketPath or TCPPort, in that order.
+func listen(config *types.FaaSConfig) (net.Listener, error) {
+	if config.Listener != nil {
+		return config.Listener, nil
+	}
+
+	if config.SocketActivation {
+		listeners, err := activationListeners()
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the first socket is used, the others are closed so that they are not leaked.
+		for _, l := range listeners[1:] {
+			l.Close()
+		}
+
+		return listeners[0], nil
+	}
+
+	if config.UnixSocketPath != "" {
+		return listenUnix(config.UnixSocketPath, config.GetUnixSocketMode())
+	}
+
+	port := 8080
+	if config.TCPPort != nil {
+		port = *config.TCPPort
+	}
+
+	return listenTCP(port)
+}
+
+// listenSplit creates the listener for a ListenerConfig from its Listener, UnixSocketPath or
+// Port, in that order.
+func listenSplit(config *types.ListenerConfig) (net.Listener, error) {
+	if config.Listener != nil {
+		return config.Listener, nil
+	}
+
+	if config.UnixSocketPath != "" {
+		return listenUnix(config.UnixSocketPath, config.GetUnixSocketMode())
+	}
+
+	return listenTCP(config.Port)
+}
+
+func listenTCP(port int) (net.Listener, error) {
+	addr := fmt.Sprintf(":%d", port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	return l, nil
+}
+
+// listenUnix listens on a Unix socket at path with the file mode, replacing a socket left
+// behind by a previous process. The socket is removed when the listener is closed.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set the mode of %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// activationListeners returns the sockets passed by systemd through the LISTEN_FDS
+// environment variable. The variables are unset, so that they are not inherited by child
+// processes.
+func activationListeners() ([]net.Listener, error) {
+	count, err := listenFDs(os.Getenv, os.Getpid())
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to use socket from file descriptor %d: %w", fd, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// listenFDs returns the number of sockets passed by systemd to the process with pid.
+func listenFDs(getenv func(string) string, pid int) (int, error) {
+	if value := getenv("LISTEN_PID"); value != "" {
+		listenPID, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for LISTEN_PID: %s", value)
+		}
+		if listenPID != pid {
+			return 0, fmt.Errorf("sockets were passed to process %d, not %d", listenPID, pid)
+		}
+	}
+
+	value := getenv("LISTEN_FDS")
+	if value == "" {
+		return 0, errors.New("no sockets were passed by systemd, LISTEN_FDS is not set")
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid value for LISTEN_FDS: %s", value)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,125 @@
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_listenFDs(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{name: "not set", env: map[string]string{}, wantErr: true},
+		{name: "one socket", env: map[string]string{"LISTEN_PID": "100", "LISTEN_FDS": "1"}, want: 1},
+		{name: "two sockets without pid", env: map[string]string{"LISTEN_FDS": "2"}, want: 2},
+		{name: "other process", env: map[string]string{"LISTEN_PID": "101", "LISTEN_FDS": "1"}, wantErr: true},
+		{name: "invalid pid", env: map[string]string{"LISTEN_PID": "systemd", "LISTEN_FDS": "1"}, wantErr: true},
+		{name: "no sockets", env: map[string]string{"LISTEN_PID": "100", "LISTEN_FDS": "0"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := listenFDs(func(key string) string { return tc.env[key] }, 100)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %d sockets", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("want no error, got: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want %d sockets, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_listen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.sock")
+
+	// A socket left behind by a previous process is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen(&types.FaaSConfig{UnixSocketPath: path, UnixSocketMode: 0600})
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	defer l.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("want mode %o, got %o", 0600, got)
+	}
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unix"))
+	}))
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	res, err := client.Get("http://provider/system/info")
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func Test_listen_Listener(t *testing.T) {
+	want, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+
+	port := 1
+	got, err := listen(&types.FaaSConfig{Listener: want, TCPPort: &port, UnixSocketPath: "unused.sock"})
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	if got != want {
+		t.Errorf("want the caller's listener, got: %s", got.Addr())
+	}
+}
+
+func Test_listen_SocketActivationError(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "0")
+
+	if _, err := listen(&types.FaaSConfig{SocketActivation: true}); err == nil {
+		t.Fatalf("want error when no sockets were passed, got nil")
+	}
+
+	if value, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Errorf("want LISTEN_FDS to be unset, got: %q", value)
+	}
+}
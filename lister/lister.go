@@ -0,0 +1,68 @@
+// Package lister lists the functions deployed to the provider, for components such as the
+// scheduler and the connector which read their configuration from function annotations.
+package lister
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// FunctionLister returns the functions deployed to a namespace.
+type FunctionLister interface {
+	// ListFunctions returns the functions in the namespace, an empty namespace
+	// is the provider's default.
+	ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error)
+}
+
+// NewHandlerFunctionLister creates a FunctionLister from the FunctionLister handler of the
+// FaaSHandlers, the handler is called directly rather than over the network.
+func NewHandlerFunctionLister(handler http.Handler) FunctionLister {
+	return &handlerFunctionLister{handler: handler}
+}
+
+type handlerFunctionLister struct {
+	handler http.Handler
+}
+
+func (l *handlerFunctionLister) ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	u := url.URL{Path: "/system/functions"}
+	if namespace != "" {
+		u.RawQuery = url.Values{"namespace": []string{namespace}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w := httputil.NewBufferedResponseWriter()
+	l.handler.ServeHTTP(w, req)
+
+	if w.Status() != http.StatusOK {
+		return nil, fmt.Errorf("unable to list functions, status code: %d, %s", w.Status(), bytes.TrimSpace(w.Body()))
+	}
+
+	var functions []types.FunctionStatus
+	if err := json.Unmarshal(w.Body(), &functions); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal functions: %w", err)
+	}
+
+	return functions, nil
+}
+
+// QualifiedName returns the name of the function followed by its namespace, such as
+// "figlet.openfaas-fn", or only its name when the namespace is empty.
+func QualifiedName(fn types.FunctionStatus) string {
+	if fn.Namespace == "" {
+		return fn.Name
+	}
+
+	return fn.Name + "." + fn.Namespace
+}
@@ -0,0 +1,52 @@
+package lister
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_NewHandlerFunctionLister(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get("namespace")
+		json.NewEncoder(w).Encode([]types.FunctionStatus{{Name: "report", Namespace: namespace}})
+	})
+
+	functions, err := NewHandlerFunctionLister(handler).ListFunctions(context.Background(), "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(functions) != 1 || functions[0].Name != "report" || functions[0].Namespace != "staging" {
+		t.Errorf("want report in staging, got %v", functions)
+	}
+}
+
+func Test_NewHandlerFunctionLister_Error(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "namespace not found", http.StatusBadRequest)
+	})
+
+	if _, err := NewHandlerFunctionLister(handler).ListFunctions(context.Background(), "missing"); err == nil {
+		t.Error("want error for a non-200 response")
+	}
+}
+
+func Test_QualifiedName(t *testing.T) {
+	cases := []struct {
+		fn   types.FunctionStatus
+		want string
+	}{
+		{fn: types.FunctionStatus{Name: "figlet"}, want: "figlet"},
+		{fn: types.FunctionStatus{Name: "figlet", Namespace: "openfaas-fn"}, want: "figlet.openfaas-fn"},
+	}
+
+	for _, tc := range cases {
+		if got := QualifiedName(tc.fn); got != tc.want {
+			t.Errorf("want %q, got %q", tc.want, got)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package logs
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -21,6 +21,12 @@ type Requester interface {
 
 // NewLogHandlerFunc creates an http HandlerFunc from the supplied log Requestor.
 func NewLogHandlerFunc(requestor Requester, timeout time.Duration) http.HandlerFunc {
+	return NewLogHandlerFuncWithLogger(requestor, timeout, slog.Default())
+}
+
+// NewLogHandlerFuncWithLogger creates the same http HandlerFunc as NewLogHandlerFunc, but
+// writes its own logs to the given logger.
+func NewLogHandlerFuncWithLogger(requestor Requester, timeout time.Duration, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
 			defer r.Body.Close()
@@ -28,20 +34,20 @@ func NewLogHandlerFunc(requestor Requester, timeout time.Duration) http.HandlerF
 
 		cn, ok := w.(http.CloseNotifier)
 		if !ok {
-			log.Println("LogHandler: response is not a CloseNotifier, required for streaming response")
+			logger.Error("LogHandler: response is not a CloseNotifier, required for streaming response")
 			http.NotFound(w, r)
 			return
 		}
 		flusher, ok := w.(http.Flusher)
 		if !ok {
-			log.Println("LogHandler: response is not a Flusher, required for streaming response")
+			logger.Error("LogHandler: response is not a Flusher, required for streaming response")
 			http.NotFound(w, r)
 			return
 		}
 
 		logRequest, err := parseRequest(r)
 		if err != nil {
-			log.Printf("LogHandler: could not parse request %s", err)
+			logger.Warn("LogHandler: could not parse request", "error", err.Error())
 			httputil.Errorf(w, http.StatusUnprocessableEntity, "could not parse the log request")
 			return
 		}
@@ -73,11 +79,11 @@ func NewLogHandlerFunc(requestor Requester, timeout time.Duration) http.HandlerF
 		for messages != nil {
 			select {
 			case <-cn.CloseNotify():
-				log.Println("LogHandler: client stopped listening")
+				logger.Info("LogHandler: client stopped listening", "function", logRequest.Name, "namespace", logRequest.Namespace)
 				return
 			case msg, ok := <-messages:
 				if !ok {
-					log.Println("LogHandler: end of log stream")
+					logger.Info("LogHandler: end of log stream", "function", logRequest.Name, "namespace", logRequest.Namespace)
 					messages = nil
 					return
 				}
@@ -87,8 +93,7 @@ func NewLogHandlerFunc(requestor Requester, timeout time.Duration) http.HandlerF
 				if err != nil {
 					// can't actually write the status header here so we should json serialize an error
 					// and return that because we have already sent the content type and status code
-					log.Printf("LogHandler: failed to serialize log message: '%s'\n", msg.String())
-					log.Println(err.Error())
+					logger.Error("LogHandler: failed to serialize log message", "message", msg.String(), "error", err.Error())
 					// write json error message here ?
 					jsonEncoder.Encode(Message{Text: "failed to serialize log message"})
 					flusher.Flush()
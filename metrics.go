@@ -3,6 +3,7 @@ package bootstrap
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/openfaas/faas-provider/httputil"
@@ -20,6 +21,10 @@ type httpMetrics struct {
 	RequestDurationHistogram *prometheus.HistogramVec
 }
 
+// sharedHttpMetrics returns the httpMetrics shared by every handler created by NewHandler,
+// since the collectors can only be registered once.
+var sharedHttpMetrics = sync.OnceValue(newHttpMetrics)
+
 // newHttpMetrics initialises a new httpMetrics struct for
 // recording R.E.D. metrics for system endpoint calls
 func newHttpMetrics() *httpMetrics {
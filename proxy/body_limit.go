@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// MaxBodySizeAnnotation can be set on a function to override the MaxRequestBodySize
+// used by the proxy. The value is a number of bytes.
+const MaxBodySizeAnnotation = "com.openfaas.max-body-size"
+
+// MaxBodySizeResolver can optionally be implemented by a BaseURLResolver to give a function
+// its own limit for the size of request bodies, for instance from the com.openfaas.max-body-size
+// annotation.
+//
+// A zero value means that the MaxRequestBodySize from the FaaSConfig will be used.
+type MaxBodySizeResolver interface {
+	ResolveMaxBodySize(functionName string) (int64, error)
+}
+
+// MaxBodySizeFromAnnotations parses the MaxBodySizeAnnotation from a function's annotations,
+// zero is returned when the annotation is missing or can not be parsed.
+func MaxBodySizeFromAnnotations(annotations map[string]string) int64 {
+	value, ok := annotations[MaxBodySizeAnnotation]
+	if !ok {
+		return 0
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+
+	return size
+}
+
+// bodyTooLargeError is written as the JSON response when a request body exceeds the limit.
+type bodyTooLargeError struct {
+	Message  string `json:"message"`
+	Function string `json:"function"`
+	Limit    int64  `json:"limit"`
+}
+
+// resolveMaxBodySize returns the maximum request body size for a function, preferring the
+// value from a MaxBodySizeResolver over the default. Zero means no limit.
+func resolveMaxBodySize(resolver BaseURLResolver, functionName string, defaultSize int64, logger *slog.Logger) int64 {
+	sizeResolver, ok := resolver.(MaxBodySizeResolver)
+	if !ok {
+		return defaultSize
+	}
+
+	size, err := sizeResolver.ResolveMaxBodySize(functionName)
+	if err != nil {
+		logger.Error("max body size resolver error", append(types.FunctionLogAttrs(functionName), "error", err.Error())...)
+		return defaultSize
+	}
+
+	if size <= 0 {
+		return defaultSize
+	}
+
+	return size
+}
+
+// limitRequestBody enforces the limit on the request body as it is streamed to the function,
+// which covers chunked uploads where the Content-Length is not known in advance. It returns
+// false when the Content-Length already exceeds the limit.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 || r.Body == nil {
+		return true
+	}
+
+	if r.ContentLength > limit {
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// isBodyTooLarge checks if err was caused by reading past the limit of the request body.
+func isBodyTooLarge(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr.Limit, true
+	}
+
+	return 0, false
+}
+
+// writeBodyTooLarge writes a 413 response with a JSON error.
+func writeBodyTooLarge(w http.ResponseWriter, functionName string, limit int64) {
+	w.Header().Add(openFaaSInternalHeader, "proxy")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+
+	json.NewEncoder(w).Encode(bodyTooLargeError{
+		Message:  "request body too large",
+		Function: functionName,
+		Limit:    limit,
+	})
+}
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheableBodySize is the largest response body which will be stored in the Cache.
+const maxCacheableBodySize = 1024 * 1024
+
+// Cache stores function responses for GET invocations. Only responses which the function
+// marks as cacheable through the Cache-Control header are stored.
+//
+// NewLRUCache provides an in-memory implementation, other backends can be used
+// through NewHandlerFuncWithCache.
+type Cache interface {
+	// Get returns the response for key, expired responses must not be returned.
+	Get(key string) (*CachedResponse, bool)
+
+	// Set stores the response for key until its Expires time. Each resource is stored as
+	// an index of its Vary headers, with no body, and an entry for each variant.
+	Set(key string, response *CachedResponse)
+}
+
+// CachedResponse is a function response which has been stored in a Cache.
+type CachedResponse struct {
+	// StatusCode from the function's response
+	StatusCode int
+
+	// Header from the function's response
+	Header http.Header
+
+	// Body from the function's response
+	Body []byte
+
+	// Vary lists the request headers which select between variants of the response
+	Vary []string
+
+	// Stored is when the response was added to the Cache
+	Stored time.Time
+
+	// Expires is when the response is no longer fresh
+	Expires time.Time
+}
+
+// responseCache decides which invocations can be served from and stored in the Cache.
+//
+// Responses are keyed on the function name, path and query string, along with the
+// values of any request headers named in the response's Vary header. The Vary header
+// names themselves are stored under the key of the resource, so that they are known
+// before the variant is looked up.
+type responseCache struct {
+	cache Cache
+}
+
+// lookup returns a fresh response for the request when one is in the cache.
+func (c *responseCache) lookup(req *http.Request, functionName, path string) (*CachedResponse, bool) {
+	if !isCacheableRequest(req) {
+		return nil, false
+	}
+
+	resourceKey := cacheResourceKey(functionName, path, req.URL.RawQuery)
+
+	var vary []string
+	if index, ok := c.cache.Get(resourceKey); ok {
+		vary = index.Vary
+	}
+
+	cached, ok := c.cache.Get(cacheVariantKey(resourceKey, vary, req.Header))
+	if !ok || time.Now().After(cached.Expires) {
+		return nil, false
+	}
+
+	return cached, true
+}
+
+// store adds the response to the cache when the function allows it. The response
+// body is buffered, so response.Body is replaced and can still be read after store
+// returns.
+func (c *responseCache) store(req *http.Request, functionName, path string, response *http.Response) {
+	if !isCacheableRequest(req) || response.StatusCode != http.StatusOK || response.Body == nil {
+		return
+	}
+
+	// A cookie set for one client must not be replayed to another by this shared cache.
+	if len(response.Header.Values("Set-Cookie")) > 0 {
+		return
+	}
+
+	ttl, ok := cacheTTL(response.Header)
+	if !ok {
+		return
+	}
+
+	vary := parseVary(response.Header)
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxCacheableBodySize+1))
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+
+	if err != nil || len(body) > maxCacheableBodySize {
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	resourceKey := cacheResourceKey(functionName, path, req.URL.RawQuery)
+	c.cache.Set(resourceKey, &CachedResponse{
+		Vary:    vary,
+		Stored:  now,
+		Expires: expires,
+	})
+
+	c.cache.Set(cacheVariantKey(resourceKey, vary, req.Header), &CachedResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header.Clone(),
+		Body:       body,
+		Vary:       vary,
+		Stored:     now,
+		Expires:    expires,
+	})
+}
+
+// isCacheableRequest checks that the request is a GET which the client has not
+// asked to bypass the cache for, and which does not carry credentials or cookies.
+func isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return false
+	}
+
+	directives := parseCacheControl(req.Header)
+	_, noStore := directives["no-store"]
+	_, noCache := directives["no-cache"]
+
+	return !noStore && !noCache
+}
+
+// cacheTTL returns how long a response can be stored for according to its
+// Cache-Control header, preferring s-maxage over max-age as this is a shared cache.
+func cacheTTL(header http.Header) (time.Duration, bool) {
+	directives := parseCacheControl(header)
+
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return 0, false
+		}
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[directive]
+		if !ok {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, with any values.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+
+			directives[strings.ToLower(name)] = strings.Trim(val, `"`)
+		}
+	}
+
+	return directives
+}
+
+// parseVary returns the canonical header names from the Vary header.
+func parseVary(header http.Header) []string {
+	var vary []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, textproto.CanonicalMIMEHeaderKey(name))
+			}
+		}
+	}
+
+	return vary
+}
+
+func cacheResourceKey(functionName, path, rawQuery string) string {
+	return functionName + "\x00" + path + "?" + rawQuery
+}
+
+func cacheVariantKey(resourceKey string, vary []string, header http.Header) string {
+	key := resourceKey + "\x00variant"
+	for _, name := range vary {
+		key += "\x00" + name + "=" + strings.Join(header.Values(name), ",")
+	}
+
+	return key
+}
+
+// etagMatches checks an If-None-Match header against an ETag using the weak
+// comparison required for conditional GET requests.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeNotModified answers a conditional request which matched the cached response.
+func writeNotModified(w http.ResponseWriter, cached *CachedResponse) {
+	for _, name := range []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary"} {
+		if values := cached.Header.Values(name); len(values) > 0 {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+	}
+
+	w.Header().Set("Age", cacheAge(cached))
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// cachedHTTPResponse converts a cached response so that it can be written in the
+// same way as a response from the function.
+func cachedHTTPResponse(cached *CachedResponse) *http.Response {
+	header := cached.Header.Clone()
+	header.Set("Age", cacheAge(cached))
+
+	return &http.Response{
+		StatusCode:    cached.StatusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+	}
+}
+
+func cacheAge(cached *CachedResponse) string {
+	return strconv.Itoa(int(time.Since(cached.Stored).Seconds()))
+}
+
+// lruCache is an in-memory Cache which evicts the least recently used
+// response when it is full.
+type lruCache struct {
+	size    int
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewLRUCache creates an in-memory Cache holding up to size entries. Each cached resource
+// uses one entry for the index of its Vary headers and one for each of its variants, so a
+// cache of size entries holds about size/2 responses.
+func NewLRUCache(size int) Cache {
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) Get(key string) (*CachedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.response.Expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.response, true
+}
+
+func (c *lruCache) Set(key string, response *CachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).response = response
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
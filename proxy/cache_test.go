@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_LRUCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewLRUCache(2)
+	expires := time.Now().Add(time.Minute)
+
+	cache.Set("a", &CachedResponse{Body: []byte("a"), Expires: expires})
+	cache.Set("b", &CachedResponse{Body: []byte("b"), Expires: expires})
+
+	// Use "a" so that "b" becomes the least recently used
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("want a in the cache")
+	}
+
+	cache.Set("c", &CachedResponse{Body: []byte("c"), Expires: expires})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("want b to be evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("want %s in the cache", key)
+		}
+	}
+}
+
+func Test_LRUCache_ExpiredEntry(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", &CachedResponse{Body: []byte("a"), Expires: time.Now().Add(-time.Second)})
+
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("want expired entry to be missing")
+	}
+}
+
+func Test_cacheTTL(t *testing.T) {
+	cases := []struct {
+		cacheControl string
+		want         time.Duration
+		wantOK       bool
+	}{
+		{cacheControl: "", wantOK: false},
+		{cacheControl: "max-age=60", want: time.Minute, wantOK: true},
+		{cacheControl: "public, max-age=60, s-maxage=120", want: 2 * time.Minute, wantOK: true},
+		{cacheControl: "private, max-age=60", wantOK: false},
+		{cacheControl: "no-store", wantOK: false},
+		{cacheControl: "no-cache, max-age=60", wantOK: false},
+		{cacheControl: "max-age=0", wantOK: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.cacheControl, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Cache-Control", tc.cacheControl)
+
+			got, ok := cacheTTL(header)
+			if ok != tc.wantOK || got != tc.want {
+				t.Errorf("want %s, %t, got %s, %t", tc.want, tc.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func Test_ProxyHandler_ResponseCache(t *testing.T) {
+	var calls int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/set-cookie":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", fmt.Sprintf("session=%d", n))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "X-Tenant")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+		}
+
+		fmt.Fprintf(w, "call %d tenant %s", n, r.Header.Get("X-Tenant"))
+	}))
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout:       5 * time.Second,
+		ResponseCacheSize: 10,
+	}
+
+	serverURL := strings.TrimPrefix(svr.URL, "http://")
+	proxyFunc := NewHandlerFunc(config, &testBaseURLResolver{serverURL, nil}, false)
+
+	invoke := func(params string, header http.Header) *http.Response {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/function/foo/"+params, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req = mux.SetURLVars(req, map[string]string{"name": "foo", "params": params})
+
+		proxyFunc(w, req)
+		return w.Result()
+	}
+
+	readBody := func(res *http.Response) string {
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+
+	t.Run("second request is served from the cache", func(t *testing.T) {
+		first := readBody(invoke("/cached", nil))
+		second := invoke("/cached", nil)
+
+		if got := readBody(second); got != first {
+			t.Errorf("want cached body %q, got %q", first, got)
+		}
+
+		if second.Header.Get("Age") == "" {
+			t.Errorf("want Age header on cached response")
+		}
+	})
+
+	t.Run("matching If-None-Match gives 304", func(t *testing.T) {
+		res := invoke("/cached", http.Header{"If-None-Match": []string{`"v1"`}})
+		if res.StatusCode != http.StatusNotModified {
+			t.Errorf("want status code %d, got %d", http.StatusNotModified, res.StatusCode)
+		}
+	})
+
+	t.Run("no-store responses are not cached", func(t *testing.T) {
+		first := readBody(invoke("/no-store", nil))
+		second := readBody(invoke("/no-store", nil))
+
+		if first == second {
+			t.Errorf("want a new response, got %q twice", first)
+		}
+	})
+
+	t.Run("responses with Set-Cookie are not cached", func(t *testing.T) {
+		first := invoke("/set-cookie", nil)
+		second := invoke("/set-cookie", nil)
+
+		if got, want := second.Header.Get("Set-Cookie"), first.Header.Get("Set-Cookie"); got == want {
+			t.Errorf("want a new session cookie, got %q twice", got)
+		}
+	})
+
+	t.Run("requests with a Cookie are not cached", func(t *testing.T) {
+		cookie := http.Header{"Cookie": []string{"session=a"}}
+
+		first := readBody(invoke("/with-cookie", cookie))
+		second := readBody(invoke("/with-cookie", cookie))
+		anonymous := readBody(invoke("/with-cookie", nil))
+
+		if first == second {
+			t.Errorf("want a new response, got %q twice", first)
+		}
+
+		if anonymous == first || anonymous == second {
+			t.Errorf("want the response for the cookie not to be served to others, got %q", anonymous)
+		}
+	})
+
+	t.Run("Vary headers select the variant", func(t *testing.T) {
+		a := readBody(invoke("/vary", http.Header{"X-Tenant": []string{"a"}}))
+		b := readBody(invoke("/vary", http.Header{"X-Tenant": []string{"b"}}))
+		cachedA := readBody(invoke("/vary", http.Header{"X-Tenant": []string{"a"}}))
+
+		if a == b {
+			t.Errorf("want a different response per tenant, got %q", a)
+		}
+
+		if cachedA != a {
+			t.Errorf("want cached response %q, got %q", a, cachedA)
+		}
+	})
+}
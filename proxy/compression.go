@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	encodingZstd   = "zstd"
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// supportedEncodings is in order of preference when the client gives
+// the same weight to more than one encoding.
+var supportedEncodings = []string{encodingZstd, encodingBrotli, encodingGzip}
+
+// responseCompressor compresses function responses according to the
+// Accept-Encoding header sent by the client.
+type responseCompressor struct {
+	minSize      int
+	contentTypes []string
+}
+
+// newResponseCompressor returns nil when compression is not enabled in the config.
+func newResponseCompressor(config types.FaaSConfig) *responseCompressor {
+	if !config.EnableCompression {
+		return nil
+	}
+
+	return &responseCompressor{
+		minSize:      config.GetCompressionMinSize(),
+		contentTypes: config.GetCompressionContentTypes(),
+	}
+}
+
+// writeResponse writes the status code and compressed body of the function's response to w.
+// The headers must have already been copied to w. When false is returned the response has not
+// been written, and should be copied as-is.
+func (c *responseCompressor) writeResponse(w http.ResponseWriter, req *http.Request, res *http.Response) bool {
+	if res.Body == nil || !c.canCompress(req, res) {
+		return false
+	}
+
+	encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return false
+	}
+
+	if res.ContentLength >= 0 && res.ContentLength < int64(c.minSize) {
+		return false
+	}
+
+	// Read up to the minimum size to find out whether a response with
+	// an unknown length is worth compressing.
+	prefix := make([]byte, c.minSize)
+	n, err := io.ReadFull(res.Body, prefix)
+	prefix = prefix[:n]
+	if err != nil {
+		w.WriteHeader(res.StatusCode)
+		w.Write(prefix)
+		return true
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", encoding)
+	header.Add("Vary", "Accept-Encoding")
+
+	// The compressed body is no longer byte-for-byte identical to the function's response.
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	w.WriteHeader(res.StatusCode)
+
+	encoder, err := newEncoder(encoding, w)
+	if err != nil {
+		return true
+	}
+	defer encoder.Close()
+
+	if _, err := encoder.Write(prefix); err != nil {
+		return true
+	}
+	io.Copy(encoder, res.Body)
+
+	return true
+}
+
+// canCompress checks the request and response for anything that prevents the
+// response from being compressed, such as an existing Content-Encoding or a
+// Content-Type which is not in the allowlist.
+func (c *responseCompressor) canCompress(req *http.Request, res *http.Response) bool {
+	if req.Method == http.MethodHead {
+		return false
+	}
+
+	switch res.StatusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	if res.Header.Get("Content-Encoding") != "" || res.Header.Get("Content-Range") != "" {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(res.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	// Streaming responses need to be flushed to the client as they are written.
+	if mediaType == "text/event-stream" || mediaType == "application/x-ndjson" {
+		return false
+	}
+
+	return matchContentType(mediaType, c.contentTypes)
+}
+
+// matchContentType checks mediaType against an allowlist where entries are either
+// an exact media type or a wildcard subtype such as "text/*".
+func matchContentType(mediaType string, allowed []string) bool {
+	for _, contentType := range allowed {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if prefix, ok := strings.CutSuffix(contentType, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+
+		if mediaType == contentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiateEncoding picks the supported encoding with the highest weight in the
+// Accept-Encoding header, an empty string means that no supported encoding is accepted.
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+
+		weights[name] = weight
+	}
+
+	best := ""
+	bestWeight := 0.0
+	for _, encoding := range supportedEncodings {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+
+		if ok && weight > bestWeight {
+			best = encoding
+			bestWeight = weight
+		}
+	}
+
+	return best
+}
+
+// newEncoder creates a writer for one of the supportedEncodings.
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case encodingBrotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	default:
+		return gzip.NewWriter(w), nil
+	}
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_negotiateEncoding(t *testing.T) {
+	cases := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "gzip, deflate, br", want: "br"},
+		{acceptEncoding: "gzip, deflate, br, zstd", want: "zstd"},
+		{acceptEncoding: "br;q=0.5, gzip;q=0.8", want: "gzip"},
+		{acceptEncoding: "zstd;q=0, gzip", want: "gzip"},
+		{acceptEncoding: "*", want: "zstd"},
+		{acceptEncoding: "*;q=0.1, gzip;q=0", want: "zstd"},
+		{acceptEncoding: "GZIP", want: "gzip"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			got := negotiateEncoding(tc.acceptEncoding)
+			if got != tc.want {
+				t.Errorf("want encoding %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_matchContentType(t *testing.T) {
+	allowed := []string{"text/*", "application/json"}
+
+	cases := []struct {
+		mediaType string
+		want      bool
+	}{
+		{mediaType: "text/plain", want: true},
+		{mediaType: "text/html", want: true},
+		{mediaType: "application/json", want: true},
+		{mediaType: "application/octet-stream", want: false},
+		{mediaType: "image/png", want: false},
+		{mediaType: "textual/plain", want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.mediaType, func(t *testing.T) {
+			got := matchContentType(tc.mediaType, allowed)
+			if got != tc.want {
+				t.Errorf("want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ProxyHandler_Compression(t *testing.T) {
+	largeBody := strings.Repeat(`{"message": "hello world"}`, 100)
+
+	cases := []struct {
+		name            string
+		body            string
+		contentType     string
+		contentEncoding string
+		acceptEncoding  string
+		wantEncoding    string
+	}{
+		{
+			name:           "compresses large JSON response",
+			body:           largeBody,
+			contentType:    "application/json",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+		},
+		{
+			name:           "skips when client does not accept encoding",
+			body:           largeBody,
+			contentType:    "application/json",
+			acceptEncoding: "",
+			wantEncoding:   "",
+		},
+		{
+			name:           "skips small response",
+			body:           `{"message": "hello world"}`,
+			contentType:    "application/json",
+			acceptEncoding: "gzip",
+			wantEncoding:   "",
+		},
+		{
+			name:           "skips content type not in allowlist",
+			body:           largeBody,
+			contentType:    "application/octet-stream",
+			acceptEncoding: "gzip",
+			wantEncoding:   "",
+		},
+		{
+			name:            "skips already compressed response",
+			body:            largeBody,
+			contentType:     "application/json",
+			contentEncoding: "identity-test",
+			acceptEncoding:  "gzip",
+			wantEncoding:    "identity-test",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				if tc.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tc.contentEncoding)
+				}
+				// Flush before writing so that the Content-Length is unknown
+				w.(http.Flusher).Flush()
+				io.WriteString(w, tc.body)
+			}))
+			defer svr.Close()
+
+			config := types.FaaSConfig{
+				ReadTimeout:       5 * time.Second,
+				EnableCompression: true,
+			}
+
+			serverURL := strings.TrimPrefix(svr.URL, "http://")
+			proxyFunc := NewHandlerFunc(config, &testBaseURLResolver{serverURL, nil}, false)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+
+			proxyFunc(w, req)
+
+			resp := w.Result()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("want status code `%d`, got `%d`", http.StatusOK, resp.StatusCode)
+			}
+
+			gotEncoding := resp.Header.Get("Content-Encoding")
+			if gotEncoding != tc.wantEncoding {
+				t.Fatalf("want Content-Encoding %q, got %q", tc.wantEncoding, gotEncoding)
+			}
+
+			var body io.Reader = resp.Body
+			if gotEncoding == "gzip" {
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tc.body {
+				t.Errorf("want body of %d bytes, got %d bytes", len(tc.body), len(got))
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package proxy
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -135,6 +138,42 @@ func Test_ProxyHandler_ResolveError(t *testing.T) {
 	}
 }
 
+func Test_ProxyHandler_ResolveError_StructuredLogs(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	config := types.FaaSConfig{
+		ReadTimeout: 100 * time.Millisecond,
+		Logger:      types.NewLogger(logs, types.LogFormatJSON, slog.LevelInfo),
+	}
+	proxyFunc := NewHandlerFunc(config, &testBaseURLResolver{"", errors.New("not found")}, false)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo.openfaas-fn", nil)
+	req.Header.Set("X-Call-Id", "call-1")
+	req = mux.SetURLVars(req, map[string]string{"name": "foo.openfaas-fn"})
+
+	proxyFunc(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("want a JSON log line, got %q: %s", logs.String(), err)
+	}
+
+	want := map[string]any{"function": "foo", "namespace": "openfaas-fn", "call_id": "call-1", "error": "not found"}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("want %s=%v, got %v", key, value, line[key])
+		}
+	}
+
+	logs.Reset()
+	config.DisableInvocationLogs = true
+	NewHandlerFunc(config, &testBaseURLResolver{"", errors.New("not found")}, false)(httptest.NewRecorder(), req)
+
+	if logs.Len() != 0 {
+		t.Errorf("want no invocation logs, got %q", logs.String())
+	}
+}
+
 func Test_ProxyHandler_Proxy_Success(t *testing.T) {
 	testFuncService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
@@ -212,3 +251,252 @@ func Test_ProxyHandler_Proxy_FailsMidFlight(t *testing.T) {
 		t.Errorf("expected X-OpenFaaS-Internal header to be `proxy`, got %s", v)
 	}
 }
+
+type testTimeoutResolver struct {
+	testBaseURLResolver
+	timeout time.Duration
+}
+
+func (tr *testTimeoutResolver) ResolveTimeout(name string) (time.Duration, error) {
+	return tr.timeout, nil
+}
+
+func Test_ProxyHandler_Proxy_FunctionTimeout(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	serverURL := strings.TrimPrefix(svr.URL, "http://")
+	resolver := &testTimeoutResolver{
+		testBaseURLResolver: testBaseURLResolver{serverURL, nil},
+		timeout:             50 * time.Millisecond,
+	}
+	proxyFunc := NewHandlerFunc(config, resolver, false)
+
+	w := httptest.NewRecorder()
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+
+	proxyFunc(w, req)
+	resp := w.Result()
+	wantCode := http.StatusGatewayTimeout
+	if resp.StatusCode != wantCode {
+		t.Fatalf("want status code `%d`, got `%d`", wantCode, resp.StatusCode)
+	}
+
+	if v := resp.Header.Get("X-OpenFaaS-Internal"); v != "proxy" {
+		t.Errorf("expected X-OpenFaaS-Internal header to be `proxy`, got %s", v)
+	}
+}
+
+func Test_ProxyHandler_Proxy_FunctionTimeout_ReverseProxy(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	serverURL := strings.TrimPrefix(svr.URL, "http://")
+	resolver := &testTimeoutResolver{
+		testBaseURLResolver: testBaseURLResolver{serverURL, nil},
+		timeout:             50 * time.Millisecond,
+	}
+	proxyFunc := NewHandlerFunc(config, resolver, false)
+
+	w := httptest.NewRecorder()
+
+	// Server-sent events are proxied by the stdlib reverse proxy rather than the client.
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+
+	start := time.Now()
+	proxyFunc(w, req)
+	resp := w.Result()
+
+	wantCode := http.StatusGatewayTimeout
+	if resp.StatusCode != wantCode {
+		t.Fatalf("want status code `%d`, got `%d`", wantCode, resp.StatusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("want the request to time out after 50ms, took %s", elapsed)
+	}
+
+	if v := resp.Header.Get("X-OpenFaaS-Internal"); v != "proxy" {
+		t.Errorf("expected X-OpenFaaS-Internal header to be `proxy`, got %s", v)
+	}
+}
+
+func Test_TimeoutFromAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        time.Duration
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        0,
+		},
+		{
+			name:        "seconds",
+			annotations: map[string]string{TimeoutAnnotation: "30"},
+			want:        30 * time.Second,
+		},
+		{
+			name:        "duration",
+			annotations: map[string]string{TimeoutAnnotation: "2m30s"},
+			want:        150 * time.Second,
+		},
+		{
+			name:        "invalid value",
+			annotations: map[string]string{TimeoutAnnotation: "forever"},
+			want:        0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TimeoutFromAnnotations(tc.annotations)
+			if got != tc.want {
+				t.Errorf("want timeout %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+type testMaxBodySizeResolver struct {
+	testBaseURLResolver
+	maxBodySize int64
+}
+
+func (tr *testMaxBodySizeResolver) ResolveMaxBodySize(name string) (int64, error) {
+	return tr.maxBodySize, nil
+}
+
+func Test_ProxyHandler_Proxy_BodyTooLarge(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout:        5 * time.Second,
+		WriteTimeout:       5 * time.Second,
+		MaxRequestBodySize: 1024,
+	}
+
+	serverURL := strings.TrimPrefix(svr.URL, "http://")
+
+	cases := []struct {
+		name          string
+		resolver      BaseURLResolver
+		body          io.Reader
+		contentLength int64
+		accept        string
+		wantCode      int
+	}{
+		{
+			name:          "within limit",
+			resolver:      &testBaseURLResolver{serverURL, nil},
+			body:          strings.NewReader(strings.Repeat("a", 512)),
+			contentLength: 512,
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "content length over limit",
+			resolver:      &testBaseURLResolver{serverURL, nil},
+			body:          strings.NewReader(strings.Repeat("a", 2048)),
+			contentLength: 2048,
+			wantCode:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "chunked body over limit",
+			resolver:      &testBaseURLResolver{serverURL, nil},
+			body:          io.NopCloser(strings.NewReader(strings.Repeat("a", 2048))),
+			contentLength: -1,
+			wantCode:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "chunked body over limit with stdlib proxy",
+			resolver:      &testBaseURLResolver{serverURL, nil},
+			body:          io.NopCloser(strings.NewReader(strings.Repeat("a", 2048))),
+			contentLength: -1,
+			accept:        "text/event-stream",
+			wantCode:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "per-function limit overrides the default",
+			resolver: &testMaxBodySizeResolver{
+				testBaseURLResolver: testBaseURLResolver{serverURL, nil},
+				maxBodySize:         4096,
+			},
+			body:          io.NopCloser(strings.NewReader(strings.Repeat("a", 2048))),
+			contentLength: -1,
+			wantCode:      http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxyFunc := NewHandlerFunc(config, tc.resolver, false)
+
+			w := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", tc.body)
+			req.ContentLength = tc.contentLength
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+
+			proxyFunc(w, req)
+			resp := w.Result()
+			if resp.StatusCode != tc.wantCode {
+				t.Fatalf("want status code `%d`, got `%d`", tc.wantCode, resp.StatusCode)
+			}
+
+			if tc.wantCode != http.StatusRequestEntityTooLarge {
+				return
+			}
+
+			if v := resp.Header.Get("Content-Type"); v != "application/json" {
+				t.Errorf("want Content-Type application/json, got %q", v)
+			}
+
+			var body bodyTooLargeError
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("unable to decode error: %s", err)
+			}
+
+			if body.Function != "foo" || body.Limit != 1024 {
+				t.Errorf("unexpected error body: %+v", body)
+			}
+		})
+	}
+}
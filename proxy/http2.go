@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/gorilla/mux"
+	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+	"golang.org/x/net/http2"
+)
+
+// newH2CTransport creates a transport for cleartext HTTP/2 with prior knowledge, which is
+// how gRPC and other HTTP/2 servers are reached without TLS. Connections are multiplexed,
+// and idle connections are health-checked with pings so that a broken connection to a
+// replica is not kept in the pool.
+func newH2CTransport(timeout time.Duration) *http2.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ReadIdleTimeout: 30 * time.Second,
+		PingTimeout:     15 * time.Second,
+	}
+}
+
+// newGRPCReverseProxy creates a reverse proxy for gRPC requests. gRPC requires HTTP/2, so
+// when the UpstreamProtocol is HTTP/1.1, requests are sent with h2c instead.
+func newGRPCReverseProxy(config types.FaaSConfig, transport http.RoundTripper) *httputil.ReverseProxy {
+	if config.GetUpstreamProtocol() == types.UpstreamHTTP1 {
+		transport = newH2CTransport(config.GetReadTimeout())
+	}
+
+	logger := config.GetInvocationLogger()
+
+	return &httputil.ReverseProxy{
+		// The URL has already been set from the resolver, including its scheme.
+		Director:  func(req *http.Request) {},
+		Transport: transport,
+		// Flush each message as it arrives for streaming RPCs.
+		FlushInterval: -1,
+		ErrorLog:      log.New(io.Discard, "", 0),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			functionName := mux.Vars(r)["name"]
+			if limit, ok := isBodyTooLarge(err); ok {
+				writeBodyTooLarge(w, functionName, limit)
+				return
+			}
+
+			if writeTimeout(w, r, err) {
+				return
+			}
+
+			logger.Error("error with gRPC proxy request", requestLogAttrs(r, functionName,
+				"url", r.URL.String(), "error", err.Error())...)
+
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+			fhttputil.Errorf(w, http.StatusBadGateway, "Can't reach service for: %s.", functionName)
+		},
+	}
+}
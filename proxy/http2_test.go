@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func newH2CTestServer(handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func Test_NewProxyClientFromConfig_H2C(t *testing.T) {
+	svr := newH2CTestServer(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout:      5 * time.Second,
+		UpstreamProtocol: types.UpstreamH2C,
+	}
+
+	client := NewProxyClientFromConfig(config)
+	res, err := client.Get(svr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("want upstream protocol HTTP/2.0, got %q", string(body))
+	}
+}
+
+func Test_NewProxyClientFromConfig_H2C_MaxConnsPerHost(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("want panic for MaxConnsPerHost with h2c")
+		}
+	}()
+
+	NewProxyClientFromConfig(types.FaaSConfig{
+		UpstreamProtocol: types.UpstreamH2C,
+		MaxConnsPerHost:  10,
+	})
+}
+
+func Test_NewProxyClientFromConfig_H2(t *testing.T) {
+	config := types.FaaSConfig{
+		UpstreamProtocol: types.UpstreamH2,
+		MaxConnsPerHost:  10,
+	}
+
+	client := NewProxyClientFromConfig(config)
+	transport := client.Transport.(*http.Transport)
+
+	if !transport.ForceAttemptHTTP2 {
+		t.Errorf("want ForceAttemptHTTP2 to be set for h2")
+	}
+
+	if transport.MaxConnsPerHost != 10 {
+		t.Errorf("want MaxConnsPerHost %d, got %d", 10, transport.MaxConnsPerHost)
+	}
+}
+
+func Test_ProxyHandler_GRPC(t *testing.T) {
+	svr := newH2CTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, r.Body)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	defer svr.Close()
+
+	config := types.FaaSConfig{
+		ReadTimeout: 5 * time.Second,
+	}
+
+	serverURL := strings.TrimPrefix(svr.URL, "http://")
+	proxyFunc := NewHandlerFunc(config, &testBaseURLResolver{serverURL, nil}, false)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/function/foo/helloworld.Greeter/SayHello", strings.NewReader("message"))
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", "application/grpc")
+	req = mux.SetURLVars(req, map[string]string{"name": "foo", "params": "/helloworld.Greeter/SayHello"})
+
+	proxyFunc(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "message" {
+		t.Errorf("want body %q, got %q", "message", string(body))
+	}
+
+	if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("want Grpc-Status trailer %q, got %q", "0", got)
+	}
+}
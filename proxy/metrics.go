@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultTimeout = "timeout"
+
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// invocationTotal counts function invocations made through the proxy partitioned by
+// function name, status code and the result of the upstream call.
+var invocationTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "function_invocation_total",
+	Help:      "Total number of function invocations made by the proxy.",
+}, []string{"function_name", "code", "result"})
+
+func recordInvocation(functionName string, code int, result string) {
+	invocationTotal.With(prometheus.Labels{
+		"function_name": functionName,
+		"code":          strconv.Itoa(code),
+		"result":        result,
+	}).Inc()
+}
+
+// cacheLookupTotal counts lookups in the response cache partitioned by function name and
+// whether the lookup was a hit or a miss.
+var cacheLookupTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "function_cache_lookup_total",
+	Help:      "Total number of response cache lookups made by the proxy.",
+}, []string{"function_name", "result"})
+
+func recordCacheLookup(functionName string, result string) {
+	cacheLookupTotal.With(prometheus.Labels{
+		"function_name": functionName,
+		"result":        result,
+	}).Inc()
+}
+
+// trafficSplitTotal counts requests for functions with a traffic split partitioned by the
+// requested function and the variant which served the request.
+var trafficSplitTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "function_traffic_split_total",
+	Help:      "Total number of requests routed by a traffic split.",
+}, []string{"function_name", "variant"})
+
+func recordTrafficSplit(functionName string, variant string) {
+	trafficSplitTotal.With(prometheus.Labels{
+		"function_name": functionName,
+		"variant":       variant,
+	}).Inc()
+}
+
+// mirrorTotal counts the mirrored requests completed by the primary and the shadow function
+// partitioned by the requested function, the target and the status code.
+var mirrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "function_mirror_total",
+	Help:      "Total number of mirrored requests completed by the primary and shadow function.",
+}, []string{"function_name", "target", "code"})
+
+// mirrorDuration records the latency of mirrored requests for the primary and the shadow
+// function, so that they can be compared.
+var mirrorDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: "provider",
+	Name:      "function_mirror_duration_seconds",
+	Help:      "Latency of mirrored requests to the primary and shadow function.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"function_name", "target"})
+
+// mirrorDroppedTotal counts requests which were not mirrored because too many requests to
+// shadow functions were in progress.
+var mirrorDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "function_mirror_dropped_total",
+	Help:      "Total number of requests not mirrored due to the in-flight limit.",
+}, []string{"function_name"})
+
+func recordMirror(functionName string, target string, code int, duration time.Duration) {
+	mirrorTotal.With(prometheus.Labels{
+		"function_name": functionName,
+		"target":        target,
+		"code":          strconv.Itoa(code),
+	}).Inc()
+
+	mirrorDuration.With(prometheus.Labels{
+		"function_name": functionName,
+		"target":        target,
+	}).Observe(duration.Seconds())
+}
+
+func recordMirrorDropped(functionName string) {
+	mirrorDroppedTotal.With(prometheus.Labels{"function_name": functionName}).Inc()
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// MirrorHeader is set on the copies of requests sent to a shadow function, so that the
+	// shadow can avoid side-effects such as sending emails twice.
+	MirrorHeader = "X-OpenFaaS-Mirror"
+
+	defaultMirrorMaxBodySize = 1024 * 1024
+	defaultMirrorTimeout     = 30 * time.Second
+	defaultMirrorMaxInFlight = 100
+
+	mirrorPrimary = "primary"
+	mirrorShadow  = "shadow"
+)
+
+// MirrorConfig copies a fraction of the requests for a function to a shadow function, such
+// as a rewrite which is being tested against production traffic. The shadow's responses are
+// discarded, but their status and latency are recorded in metrics alongside those of the
+// primary function.
+type MirrorConfig struct {
+	// Functions maps the name of a function to the shadow function which receives copies
+	// of its requests
+	Functions map[string]string
+
+	// Fraction of the requests to copy, greater than 0 and up to 1 to copy all requests
+	Fraction float64
+
+	// MaxBodySize is the largest request body which is buffered to be copied, requests with
+	// larger bodies are not mirrored. The default is 1MB.
+	MaxBodySize int64
+
+	// Timeout for requests to the shadow function, the default is 30s
+	Timeout time.Duration
+
+	// MaxInFlight limits the requests to shadow functions in progress, requests are not
+	// mirrored beyond the limit. The default is 100.
+	MaxInFlight int
+}
+
+// requestMirror sends copies of requests to shadow functions in the background.
+type requestMirror struct {
+	functions   map[string]string
+	fraction    float64
+	maxBodySize int64
+	timeout     time.Duration
+	inFlight    chan struct{}
+}
+
+// Validate checks that the Fraction is greater than 0 and no more than 1, and that the
+// shadow functions are named.
+func (c MirrorConfig) Validate() error {
+	if c.Fraction <= 0 || c.Fraction > 1 {
+		return fmt.Errorf("fraction must be greater than 0 and no more than 1, got %v", c.Fraction)
+	}
+
+	for function, shadow := range c.Functions {
+		if shadow == "" {
+			return fmt.Errorf("shadow function is required for %s", function)
+		}
+	}
+
+	return nil
+}
+
+// WithMirror copies a fraction of requests to shadow functions, see MirrorConfig. Streaming,
+// WebSocket and gRPC requests are not mirrored. An error is returned when the config is
+// not valid.
+func WithMirror(config MirrorConfig) (Option, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMirrorMaxBodySize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultMirrorTimeout
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = defaultMirrorMaxInFlight
+	}
+
+	mirror := &requestMirror{
+		functions:   config.Functions,
+		fraction:    config.Fraction,
+		maxBodySize: config.MaxBodySize,
+		timeout:     config.Timeout,
+		inFlight:    make(chan struct{}, config.MaxInFlight),
+	}
+
+	return func(p *functionProxy) {
+		p.mirror = mirror
+	}, nil
+}
+
+// mirrorRequest starts sending a copy of the request to the shadow of functionName, the
+// body of proxyReq is buffered and replaced so that it can still be sent to the function.
+// It returns false when the request is not mirrored.
+func (p *functionProxy) mirrorRequest(originalReq *http.Request, proxyReq *http.Request, functionName string, params string) bool {
+	if p.mirror == nil {
+		return false
+	}
+
+	shadow, ok := p.mirror.functions[functionName]
+	if !ok {
+		return false
+	}
+
+	if p.mirror.fraction < 1 && rand.Float64() >= p.mirror.fraction {
+		return false
+	}
+
+	var body []byte
+	if proxyReq.Body != nil && proxyReq.Body != http.NoBody {
+		if originalReq.ContentLength > p.mirror.maxBodySize {
+			return false
+		}
+
+		buf, err := io.ReadAll(io.LimitReader(proxyReq.Body, p.mirror.maxBodySize+1))
+		proxyReq.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buf), proxyReq.Body))
+		if err != nil || int64(len(buf)) > p.mirror.maxBodySize {
+			return false
+		}
+
+		body = buf
+	}
+
+	select {
+	case p.mirror.inFlight <- struct{}{}:
+	default:
+		recordMirrorDropped(functionName)
+		return false
+	}
+
+	shadowReq := originalReq.Clone(context.Background())
+	shadowReq.Body = nil
+	if body != nil {
+		shadowReq.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	go func() {
+		defer func() { <-p.mirror.inFlight }()
+
+		p.sendMirror(shadowReq, functionName, shadow, params)
+	}()
+
+	return true
+}
+
+// sendMirror sends the copy of a request to the shadow function and discards the response.
+func (p *functionProxy) sendMirror(shadowReq *http.Request, functionName string, shadow string, params string) {
+	start := time.Now()
+
+	shadowAddr, err := p.resolver.Resolve(shadow)
+	if err != nil {
+		p.logger.Error("resolver error: no endpoints for shadow", append(types.FunctionLogAttrs(functionName),
+			"shadow", shadow, "error", err.Error())...)
+		recordMirror(functionName, mirrorShadow, http.StatusServiceUnavailable, time.Since(start))
+		return
+	}
+
+	req, err := buildProxyRequest(shadowReq, shadowAddr, params)
+	if err != nil {
+		p.logger.Error("error building mirror request", append(types.FunctionLogAttrs(functionName),
+			"shadow", shadow, "error", err.Error())...)
+		recordMirror(functionName, mirrorShadow, http.StatusInternalServerError, time.Since(start))
+		return
+	}
+	req.Header.Set(MirrorHeader, "true")
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.mirror.timeout)
+	defer cancel()
+
+	response, err := p.timeoutClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			recordMirror(functionName, mirrorShadow, http.StatusGatewayTimeout, time.Since(start))
+			return
+		}
+
+		p.logger.Error("error with mirror request", append(types.FunctionLogAttrs(functionName),
+			"shadow", shadow, "url", req.URL.String(), "error", err.Error())...)
+		recordMirror(functionName, mirrorShadow, http.StatusInternalServerError, time.Since(start))
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+
+	recordMirror(functionName, mirrorShadow, response.StatusCode, time.Since(start))
+}
+
+// upstreamStatus is the status code recorded for a request to a function, for errors it
+// matches the status code written by the proxy.
+func upstreamStatus(response *http.Response, err error) int {
+	if err == nil {
+		return response.StatusCode
+	}
+
+	if _, ok := isBodyTooLarge(err); ok {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
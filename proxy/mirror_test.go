@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type mirroredRequest struct {
+	path   string
+	body   string
+	header string
+}
+
+func Test_ProxyHandler_Mirror(t *testing.T) {
+	shadowRequests := make(chan mirroredRequest, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		shadowRequests <- mirroredRequest{path: r.URL.Path, body: string(body), header: r.Header.Get(MirrorHeader)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	resolver := &trafficResolver{
+		hosts: map[string]string{
+			"foo":    newVariantServer(t, "foo"),
+			"foo-v2": strings.TrimPrefix(shadow.URL, "http://"),
+		},
+	}
+
+	mirror, err := WithMirror(MirrorConfig{Functions: map[string]string{"foo": "foo-v2"}, Fraction: 1, MaxBodySize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxyFunc := NewHandlerFunc(types.FaaSConfig{ReadTimeout: 5 * time.Second}, resolver, false, mirror)
+
+	invoke := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://gateway/function/foo/orders", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"name": "foo", "params": "/orders"})
+
+		w := httptest.NewRecorder()
+		proxyFunc(w, req)
+		return w
+	}
+
+	w := invoke("order-1")
+	if w.Code != http.StatusOK || w.Body.String() != "foo" {
+		t.Fatalf("want the primary response, got %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case got := <-shadowRequests:
+		want := mirroredRequest{path: "/orders", body: "order-1", header: "true"}
+		if got != want {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the request to be mirrored")
+	}
+
+	// Bodies over the MaxBodySize are sent to the primary function only.
+	w = invoke("a body over the limit")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	select {
+	case got := <-shadowRequests:
+		t.Errorf("want no mirrored request, got %v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_MirrorConfig_Validate(t *testing.T) {
+	functions := map[string]string{"foo": "foo-v2"}
+
+	cases := []struct {
+		name    string
+		config  MirrorConfig
+		wantErr bool
+	}{
+		{name: "all requests", config: MirrorConfig{Functions: functions, Fraction: 1}},
+		{name: "fraction", config: MirrorConfig{Functions: functions, Fraction: 0.1}},
+		{name: "zero fraction", config: MirrorConfig{Functions: functions}, wantErr: true},
+		{name: "negative fraction", config: MirrorConfig{Functions: functions, Fraction: -0.5}, wantErr: true},
+		{name: "fraction over 1", config: MirrorConfig{Functions: functions, Fraction: 1.5}, wantErr: true},
+		{name: "empty shadow", config: MirrorConfig{Functions: map[string]string{"foo": ""}, Fraction: 1}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := WithMirror(tc.config)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("want error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_upstreamStatus(t *testing.T) {
+	if got := upstreamStatus(&http.Response{StatusCode: http.StatusAccepted}, nil); got != http.StatusAccepted {
+		t.Errorf("want %d, got %d", http.StatusAccepted, got)
+	}
+
+	if got := upstreamStatus(nil, io.ErrUnexpectedEOF); got != http.StatusInternalServerError {
+		t.Errorf("want %d, got %d", http.StatusInternalServerError, got)
+	}
+}
@@ -22,8 +22,11 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -33,7 +36,13 @@ import (
 
 	"github.com/gorilla/mux"
 	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/tracing"
 	"github.com/openfaas/faas-provider/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -52,8 +61,8 @@ type BaseURLResolver interface {
 }
 
 // NewHandlerFunc creates a standard http.HandlerFunc to proxy function requests.
-// When verbose is set to true, the timing of each invocation will be printed out to
-// stderr.
+// When verbose is set to true, the timing of each invocation will be logged with the
+// invocation logger from the config.
 // The returned http.HandlerFunc will ensure:
 //
 //   - proper proxy request timeouts
@@ -61,26 +70,82 @@ type BaseURLResolver interface {
 //   - path parsing including support for extracing the function name, sub-paths, and query paremeters
 //   - passing and setting the `X-Forwarded-Host` and `X-Forwarded-For` headers
 //   - logging errors and proxy request timing to stdout
+//   - request bodies larger than the MaxRequestBodySize are rejected with a 413
+//   - optional gzip, zstd and brotli compression of responses when EnableCompression is set
+//   - optional caching of GET responses according to the function's Cache-Control header
+//   - optional traffic splitting between versions of a function, see TrafficSplitResolver
+//   - optional mirroring of requests to a shadow function, see WithMirror
+//
+// Responses to GET requests are cached in memory when the ResponseCacheSize is set,
+// see NewHandlerFuncWithCache to use another Cache backend.
+//
+// Options such as WithTrafficSplits and WithMirror are applied to the proxy in order.
+//
+// Note that this will panic if `resolver` is nil.
+func NewHandlerFunc(config types.FaaSConfig, resolver BaseURLResolver, verbose bool, options ...Option) http.HandlerFunc {
+	var cache Cache
+	if config.ResponseCacheSize > 0 {
+		cache = NewLRUCache(config.ResponseCacheSize)
+	}
+
+	return NewHandlerFuncWithCache(config, resolver, cache, verbose, options...)
+}
+
+// NewHandlerFuncWithCache creates the same http.HandlerFunc as NewHandlerFunc, but stores
+// cacheable responses to GET requests in the given Cache. A nil Cache disables caching.
 //
 // Note that this will panic if `resolver` is nil.
-func NewHandlerFunc(config types.FaaSConfig, resolver BaseURLResolver, verbose bool) http.HandlerFunc {
+func NewHandlerFuncWithCache(config types.FaaSConfig, resolver BaseURLResolver, cache Cache, verbose bool, options ...Option) http.HandlerFunc {
 	if resolver == nil {
 		panic("NewHandlerFunc: empty proxy handler resolver, cannot be nil")
 	}
 
 	proxyClient := NewProxyClientFromConfig(config)
 
+	// Functions with their own timeout share the transport, but have their deadline applied
+	// through the request context so that it can be longer than the global ReadTimeout.
+	timeoutClient := *proxyClient
+	timeoutClient.Timeout = 0
+
 	reverseProxy := httputil.ReverseProxy{}
 	reverseProxy.Director = func(req *http.Request) {
 		// At least an empty director is required to prevent runtime errors.
 		req.URL.Scheme = "http"
 	}
 	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if limit, ok := isBodyTooLarge(err); ok {
+			writeBodyTooLarge(w, mux.Vars(r)["name"], limit)
+			return
+		}
+
+		writeTimeout(w, r, err)
 	}
 
 	// Errors are common during disconnect of client, no need to log them.
 	reverseProxy.ErrorLog = log.New(io.Discard, "", 0)
 
+	grpcProxy := newGRPCReverseProxy(config, proxyClient.Transport)
+
+	p := &functionProxy{
+		client:        proxyClient,
+		timeoutClient: &timeoutClient,
+		resolver:      resolver,
+		reverseProxy:  &reverseProxy,
+		grpcProxy:     grpcProxy,
+		maxBodySize:   config.MaxRequestBodySize,
+		compressor:    newResponseCompressor(config),
+		verbose:       verbose,
+		logger:        config.GetInvocationLogger(),
+	}
+
+	if cache != nil {
+		p.cache = &responseCache{cache: cache}
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
 			defer r.Body.Close()
@@ -94,7 +159,7 @@ func NewHandlerFunc(config types.FaaSConfig, resolver BaseURLResolver, verbose b
 			http.MethodGet,
 			http.MethodOptions,
 			http.MethodHead:
-			proxyRequest(w, r, proxyClient, resolver, &reverseProxy, verbose)
+			p.proxyRequest(w, r)
 
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -104,8 +169,31 @@ func NewHandlerFunc(config types.FaaSConfig, resolver BaseURLResolver, verbose b
 
 // NewProxyClientFromConfig creates a new http.Client designed for proxying requests and enforcing
 // certain minimum configuration values.
+//
+// The UpstreamProtocol in the config selects between HTTP/1.1, cleartext HTTP/2 (h2c) or HTTP/2
+// over TLS for the connections to functions. The h2c transport keeps one multiplexed connection
+// per replica, so the connection pool settings do not apply to it.
+//
+// Note that this will panic if MaxConnsPerHost is set with the h2c UpstreamProtocol.
 func NewProxyClientFromConfig(config types.FaaSConfig) *http.Client {
-	return NewProxyClient(config.GetReadTimeout(), config.GetMaxIdleConns(), config.GetMaxIdleConnsPerHost())
+	if config.MaxConnsPerHost > 0 && config.GetUpstreamProtocol() == types.UpstreamH2C {
+		panic("NewProxyClientFromConfig: MaxConnsPerHost is not supported with the h2c UpstreamProtocol")
+	}
+
+	client := NewProxyClient(config.GetReadTimeout(), config.GetMaxIdleConns(), config.GetMaxIdleConnsPerHost())
+
+	transport := client.Transport.(*http.Transport)
+	transport.MaxConnsPerHost = config.MaxConnsPerHost
+
+	switch config.GetUpstreamProtocol() {
+	case types.UpstreamH2C:
+		client.Transport = newH2CTransport(config.GetReadTimeout())
+	case types.UpstreamH2:
+		// A custom DialContext disables HTTP/2 unless it is forced.
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	return client
 }
 
 // NewProxyClient creates a new http.Client designed for proxying requests, this is exposed as a
@@ -144,25 +232,102 @@ func NewProxyClient(timeout time.Duration, maxIdleConns int, maxIdleConnsPerHost
 	}
 }
 
+// Option configures an optional feature of the handler created by NewHandlerFunc.
+type Option func(*functionProxy)
+
+// functionProxy holds the clients and settings shared by each invocation handled by NewHandlerFunc.
+type functionProxy struct {
+	client        *http.Client
+	timeoutClient *http.Client
+	resolver      BaseURLResolver
+	reverseProxy  *httputil.ReverseProxy
+
+	// grpcProxy forwards gRPC requests over HTTP/2 with support for streaming and trailers.
+	grpcProxy *httputil.ReverseProxy
+
+	// maxBodySize is the default limit for request bodies, 0 means no limit.
+	maxBodySize int64
+
+	// compressor is nil when response compression is disabled.
+	compressor *responseCompressor
+
+	// cache is nil when response caching is disabled.
+	cache *responseCache
+
+	// trafficSplits is nil unless set through WithTrafficSplits.
+	trafficSplits *TrafficSplits
+
+	// mirror is nil unless set through WithMirror.
+	mirror *requestMirror
+
+	verbose bool
+
+	// logger writes the logs for each invocation, see FaaSConfig.DisableInvocationLogs.
+	logger *slog.Logger
+}
+
 // proxyRequest handles the actual resolution of and then request to the function service.
-func proxyRequest(w http.ResponseWriter, originalReq *http.Request, proxyClient *http.Client, resolver BaseURLResolver, reverseProxy *httputil.ReverseProxy, verbose bool) {
+func (p *functionProxy) proxyRequest(w http.ResponseWriter, originalReq *http.Request) {
 	ctx := originalReq.Context()
 
+	// The caller's trace is continued when the request was not traced by tracing.Middleware.
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(originalReq.Header))
+	}
+
 	pathVars := mux.Vars(originalReq)
-	functionName := pathVars["name"]
-	if functionName == "" {
+	if pathVars["name"] == "" {
 		w.Header().Add(openFaaSInternalHeader, "proxy")
 
 		fhttputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
 		return
 	}
 
-	functionAddr, err := resolver.Resolve(functionName)
+	// A traffic split may send the request to another version of the function.
+	functionName, variantCookie := p.selectVariant(originalReq, pathVars["name"])
+
+	bodyLimit := resolveMaxBodySize(p.resolver, functionName, p.maxBodySize, p.logger)
+	if !limitRequestBody(w, originalReq, bodyLimit) {
+		writeBodyTooLarge(w, functionName, bodyLimit)
+		return
+	}
+
+	cacheable := p.cache != nil && !requiresStdlibProxy(originalReq)
+	if cacheable {
+		if cached, ok := p.cache.lookup(originalReq, functionName, pathVars["params"]); ok {
+			recordCacheLookup(functionName, cacheHit)
+
+			if etagMatches(originalReq.Header.Get("If-None-Match"), cached.Header.Get("ETag")) {
+				addVariantCookie(w.Header(), variantCookie)
+				writeNotModified(w, cached)
+				return
+			}
+
+			response := cachedHTTPResponse(cached)
+			addVariantCookie(response.Header, variantCookie)
+
+			p.writeResponse(w, originalReq, response)
+			return
+		}
+
+		recordCacheLookup(functionName, cacheMiss)
+	}
+
+	_, resolveSpan := tracing.Tracer().Start(ctx, "resolve "+functionName,
+		trace.WithAttributes(tracing.FunctionAttributes(functionName)...))
+
+	functionAddr, err := p.resolver.Resolve(functionName)
+	if err != nil {
+		resolveSpan.RecordError(err)
+		resolveSpan.SetStatus(codes.Error, "no endpoints")
+	}
+	resolveSpan.End()
+
 	if err != nil {
 		w.Header().Add(openFaaSInternalHeader, "proxy")
 
 		// TODO: Should record the 404/not found error in Prometheus.
-		log.Printf("resolver error: no endpoints for %s: %s\n", functionName, err.Error())
+		p.logger.Error("resolver error: no endpoints", requestLogAttrs(originalReq, functionName, "error", err.Error())...)
 		fhttputil.Errorf(w, http.StatusServiceUnavailable, "No endpoints available for: %s.", functionName)
 		return
 	}
@@ -180,32 +345,97 @@ func proxyRequest(w http.ResponseWriter, originalReq *http.Request, proxyClient
 		defer proxyReq.Body.Close()
 	}
 
-	if verbose {
+	ctx, span := tracing.Tracer().Start(ctx, "invoke "+functionName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.FunctionAttributes(functionName)...),
+		trace.WithAttributes(attribute.String("server.address", proxyReq.URL.Host)))
+	defer span.End()
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(proxyReq.Header))
+
+	// The function's own timeout is applied through the context, so that it covers the
+	// reverse proxies as well as the client.
+	client := p.client
+	timeout, hasTimeout := resolveTimeout(p.resolver, functionName, p.logger)
+	if hasTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		client = p.timeoutClient
+	}
+
+	if p.verbose {
 		start := time.Now()
 		defer func() {
-			seconds := time.Since(start)
-			log.Printf("%s took %f seconds\n", functionName, seconds.Seconds())
+			p.logger.Info("invoked function", requestLogAttrs(originalReq, functionName,
+				"duration_seconds", time.Since(start).Seconds())...)
 		}()
 	}
 
+	// The stdlib reverse proxies add the function's headers to those already set.
+	if fhttputil.IsGRPCRequest(originalReq) {
+		originalReq.URL = proxyReq.URL
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(originalReq.Header))
+		addVariantCookie(w.Header(), variantCookie)
+
+		p.grpcProxy.ServeHTTP(w, originalReq.WithContext(ctx))
+		return
+	}
+
 	if requiresStdlibProxy(originalReq) {
 		originalReq.URL = proxyReq.URL
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(originalReq.Header))
+		addVariantCookie(w.Header(), variantCookie)
 
-		reverseProxy.ServeHTTP(w, originalReq)
+		p.reverseProxy.ServeHTTP(w, originalReq.WithContext(ctx))
 		return
 	}
 
-	response, err := proxyClient.Do(proxyReq.WithContext(ctx))
+	mirrored := p.mirrorRequest(originalReq, proxyReq, pathVars["name"], pathVars["params"])
+	start := time.Now()
+
+	response, err := client.Do(proxyReq.WithContext(ctx))
+
+	if mirrored {
+		recordMirror(pathVars["name"], mirrorPrimary, upstreamStatus(response, err), time.Since(start))
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", upstreamStatus(response, err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upstream error")
+	}
 
 	if err != nil {
-		log.Printf("error with proxy request to: %s, %s\n", proxyReq.URL.String(), err.Error())
+		if limit, ok := isBodyTooLarge(err); ok {
+			recordInvocation(functionName, http.StatusRequestEntityTooLarge, resultError)
+
+			writeBodyTooLarge(w, functionName, limit)
+			return
+		}
 
 		w.Header().Add(openFaaSInternalHeader, "proxy")
 
+		if hasTimeout && errors.Is(err, context.DeadlineExceeded) {
+			p.logger.Error("timeout with proxy request", requestLogAttrs(originalReq, functionName,
+				"url", proxyReq.URL.String(), "timeout", timeout.String())...)
+			recordInvocation(functionName, http.StatusGatewayTimeout, resultTimeout)
+
+			fhttputil.Errorf(w, http.StatusGatewayTimeout, "Timed out after %s waiting for: %s.", timeout, functionName)
+			return
+		}
+
+		p.logger.Error("error with proxy request", requestLogAttrs(originalReq, functionName,
+			"url", proxyReq.URL.String(), "error", err.Error())...)
+		recordInvocation(functionName, http.StatusInternalServerError, resultError)
+
 		fhttputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
 		return
 	}
 
+	recordInvocation(functionName, response.StatusCode, resultSuccess)
+
 	if response.Body != nil {
 		defer func() {
 			_, _ = io.Copy(io.Discard, response.Body) // drain to EOF
@@ -213,16 +443,41 @@ func proxyRequest(w http.ResponseWriter, originalReq *http.Request, proxyClient
 		}()
 	}
 
+	if cacheable {
+		p.cache.store(originalReq, functionName, pathVars["params"], response)
+	}
+
+	addVariantCookie(response.Header, variantCookie)
+
+	p.writeResponse(w, originalReq, response)
+}
+
+// writeResponse copies the function's response to the client, compressing it when enabled.
+func (p *functionProxy) writeResponse(w http.ResponseWriter, originalReq *http.Request, response *http.Response) {
 	clientHeader := w.Header()
 	copyHeaders(clientHeader, &response.Header)
 	w.Header().Set("Content-Type", getContentType(originalReq.Header, response.Header))
 
+	if p.compressor != nil && p.compressor.writeResponse(w, originalReq, response) {
+		return
+	}
+
 	w.WriteHeader(response.StatusCode)
 	if response.Body != nil {
 		io.Copy(w, response.Body)
 	}
 }
 
+// requestLogAttrs returns the fields logged for an invocation, followed by args.
+func requestLogAttrs(r *http.Request, functionName string, args ...any) []any {
+	attrs := types.FunctionLogAttrs(functionName)
+	if callID := fhttputil.CallID(r); callID != "" {
+		attrs = append(attrs, "call_id", callID)
+	}
+
+	return append(attrs, args...)
+}
+
 // requiresStdlibProxy checks if the request should be proxied using the standard library reverse proxy.
 // Support SSE, NDSJON and WebSockets through the stdlib reverse proxy
 func requiresStdlibProxy(req *http.Request) bool {
@@ -261,6 +516,9 @@ func buildProxyRequest(originalReq *http.Request, baseURL url.URL, extraPath str
 	if upstreamReq.Header.Get("X-Forwarded-For") == "" {
 		upstreamReq.Header["X-Forwarded-For"] = []string{originalReq.RemoteAddr}
 	}
+	if callID := fhttputil.CallID(originalReq); callID != "" {
+		upstreamReq.Header.Set(fhttputil.CallIDHeader, callID)
+	}
 
 	if originalReq.Body != nil {
 		upstreamReq.Body = originalReq.Body
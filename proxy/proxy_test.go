@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	fhttputil "github.com/openfaas/faas-provider/httputil"
 	"github.com/openfaas/faas-provider/types"
 )
 
@@ -295,6 +296,24 @@ func Test_buildProxyRequest_XForwardedHostHeader_WhenAlreadyPresent(t *testing.T
 	}
 }
 
+func Test_buildProxyRequest_CallIDFromContext(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "/function/test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request = request.WithContext(fhttputil.WithCallID(request.Context(), "call-1"))
+	funcURL, _ := testResolver("funcName")
+	upstream, err := buildProxyRequest(request, funcURL, "/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if got := upstream.Header.Get(fhttputil.CallIDHeader); got != "call-1" {
+		t.Errorf("X-Call-Id - want: %s, got: %s", "call-1", got)
+	}
+}
+
 func Test_proxyRequest_ContentType_Header(t *testing.T) {
 	const requestContentType = "x-www-form-urlencoded"
 	const wantContentType = "application/json"
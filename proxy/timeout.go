@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// TimeoutAnnotation can be set on a function to override the ReadTimeout used when
+// invoking it through the proxy. The value can be an integer number of seconds or a
+// Go duration such as "2m30s".
+const TimeoutAnnotation = "com.openfaas.timeout"
+
+// TimeoutResolver can optionally be implemented by a BaseURLResolver to give a function
+// its own invocation timeout, for instance from the com.openfaas.timeout annotation.
+//
+// A zero duration means that the ReadTimeout from the FaaSConfig will be used. When the
+// function's own timeout is hit, the proxy responds with a 504 Gateway Timeout.
+type TimeoutResolver interface {
+	ResolveTimeout(functionName string) (time.Duration, error)
+}
+
+// TimeoutFromAnnotations parses the TimeoutAnnotation from a function's annotations, a
+// zero duration is returned when the annotation is missing or can not be parsed.
+func TimeoutFromAnnotations(annotations map[string]string) time.Duration {
+	value, ok := annotations[TimeoutAnnotation]
+	if !ok {
+		return 0
+	}
+
+	return types.ParseIntOrDurationValue(value, 0)
+}
+
+// resolveTimeout returns the invocation timeout for a function when the resolver
+// implements TimeoutResolver and a timeout is set for the function.
+func resolveTimeout(resolver BaseURLResolver, functionName string, logger *slog.Logger) (time.Duration, bool) {
+	timeoutResolver, ok := resolver.(TimeoutResolver)
+	if !ok {
+		return 0, false
+	}
+
+	timeout, err := timeoutResolver.ResolveTimeout(functionName)
+	if err != nil {
+		logger.Error("timeout resolver error", append(types.FunctionLogAttrs(functionName), "error", err.Error())...)
+		return 0, false
+	}
+
+	return timeout, timeout > 0
+}
+
+// writeTimeout responds with a 504 Gateway Timeout when a reverse proxy failed because the
+// function's timeout was reached, and reports whether it did.
+func writeTimeout(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	functionName := mux.Vars(r)["name"]
+	recordInvocation(functionName, http.StatusGatewayTimeout, resultTimeout)
+
+	w.Header().Add(openFaaSInternalHeader, "proxy")
+	fhttputil.Errorf(w, http.StatusGatewayTimeout, "Timed out waiting for: %s.", functionName)
+	return true
+}
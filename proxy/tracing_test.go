@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_ProxyHandler_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var gotTraceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceParent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	resolver := &testBaseURLResolver{testServerBase: strings.TrimPrefix(upstream.URL, "http://")}
+	proxyFunc := NewHandlerFunc(types.FaaSConfig{ReadTimeout: 5 * time.Second}, resolver, false)
+
+	req := httptest.NewRequest(http.MethodGet, "http://gateway/function/figlet.openfaas-fn", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req = mux.SetURLVars(req, map[string]string{"name": "figlet.openfaas-fn"})
+
+	proxyFunc(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+
+	if spans[0].Name() != "resolve figlet.openfaas-fn" || spans[1].Name() != "invoke figlet.openfaas-fn" {
+		t.Errorf("want resolve and invoke spans, got %s and %s", spans[0].Name(), spans[1].Name())
+	}
+
+	invoke := spans[1]
+	if got := invoke.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want the caller's trace to be continued, got %s", got)
+	}
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + invoke.SpanContext().SpanID().String() + "-01"
+	if gotTraceParent != want {
+		t.Errorf("want traceparent %s for the function, got %s", want, gotTraceParent)
+	}
+}
@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// TrafficSplitAnnotation sends a share of a function's traffic to other versions of the
+	// function, such as "foo-canary=10" to send 10% of the requests for foo to foo-canary.
+	// Multiple variants are separated by commas, the remaining traffic goes to the function.
+	TrafficSplitAnnotation = "com.openfaas.traffic.split"
+
+	// TrafficStickyAnnotation set to "true" keeps a client on the same variant with a cookie.
+	TrafficStickyAnnotation = "com.openfaas.traffic.sticky"
+
+	// VariantHeader selects the variant of a function with a traffic split, the value is the
+	// name of the function or of one of its variants.
+	VariantHeader = "X-OpenFaaS-Variant"
+
+	// variantCookiePrefix is followed by the function name for the cookie of a sticky split.
+	variantCookiePrefix = "openfaas_variant_"
+)
+
+// TrafficVariant is another version of a function which receives a share of its traffic.
+type TrafficVariant struct {
+	// Function is the name of the function which serves the variant
+	Function string `json:"function"`
+
+	// Weight is the percentage of requests sent to the variant
+	Weight int `json:"weight"`
+}
+
+// TrafficSplit sends a share of the requests for Function to each of the Variants, the
+// remaining requests are sent to Function.
+type TrafficSplit struct {
+	Function string           `json:"function"`
+	Variants []TrafficVariant `json:"variants"`
+
+	// Sticky sets a cookie so that a client keeps using the same variant
+	Sticky bool `json:"sticky,omitempty"`
+}
+
+// Validate checks that the variants are named and that their weights add up to no more
+// than 100.
+func (s TrafficSplit) Validate() error {
+	if s.Function == "" {
+		return fmt.Errorf("function is required")
+	}
+
+	total := 0
+	seen := map[string]bool{s.Function: true}
+	for _, variant := range s.Variants {
+		if variant.Function == "" {
+			return fmt.Errorf("variant function is required")
+		}
+		if seen[variant.Function] {
+			return fmt.Errorf("variant %s is used more than once", variant.Function)
+		}
+		if variant.Weight < 0 || variant.Weight > 100 {
+			return fmt.Errorf("weight for %s must be between 0 and 100", variant.Function)
+		}
+
+		seen[variant.Function] = true
+		total += variant.Weight
+	}
+
+	if total > 100 {
+		return fmt.Errorf("weights add up to %d, must be no more than 100", total)
+	}
+
+	return nil
+}
+
+// TrafficSplitResolver can optionally be implemented by a BaseURLResolver to split the
+// traffic for a function between its variants, for instance from the
+// com.openfaas.traffic.split annotation. A nil TrafficSplit sends all traffic to the function.
+//
+// A split set through the /system/traffic API takes precedence over the resolver.
+type TrafficSplitResolver interface {
+	ResolveTrafficSplit(functionName string) (*TrafficSplit, error)
+}
+
+// TrafficSplitFromAnnotations parses the TrafficSplitAnnotation and TrafficStickyAnnotation
+// for the named function, nil is returned when there is no split.
+func TrafficSplitFromAnnotations(functionName string, annotations map[string]string) (*TrafficSplit, error) {
+	value := strings.TrimSpace(annotations[TrafficSplitAnnotation])
+	if value == "" {
+		return nil, nil
+	}
+
+	split := &TrafficSplit{Function: functionName}
+	for _, part := range strings.Split(value, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s: %q, want function=weight", TrafficSplitAnnotation, part)
+		}
+
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for %s: %s", name, err)
+		}
+
+		split.Variants = append(split.Variants, TrafficVariant{Function: strings.TrimSpace(name), Weight: w})
+	}
+
+	if sticky, ok := annotations[TrafficStickyAnnotation]; ok {
+		split.Sticky, _ = strconv.ParseBool(sticky)
+	}
+
+	if err := split.Validate(); err != nil {
+		return nil, err
+	}
+
+	return split, nil
+}
+
+// TrafficSplits holds the traffic splits set through the /system/traffic API.
+type TrafficSplits struct {
+	lock   sync.RWMutex
+	splits map[string]TrafficSplit
+}
+
+// NewTrafficSplits creates an empty set of traffic splits, use WithTrafficSplits to apply
+// them in the proxy and NewTrafficHandlerFunc to manage them.
+func NewTrafficSplits() *TrafficSplits {
+	return &TrafficSplits{
+		splits: make(map[string]TrafficSplit),
+	}
+}
+
+// Get returns the split for the function.
+func (s *TrafficSplits) Get(functionName string) (TrafficSplit, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	split, ok := s.splits[functionName]
+	return split, ok
+}
+
+// Set validates and stores the split, replacing any previous split for the function.
+func (s *TrafficSplits) Set(split TrafficSplit) error {
+	if err := split.Validate(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.splits[split.Function] = split
+	return nil
+}
+
+// Delete removes the split for the function, false is returned when there was no split.
+func (s *TrafficSplits) Delete(functionName string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.splits[functionName]
+	delete(s.splits, functionName)
+	return ok
+}
+
+// List returns the splits ordered by function name.
+func (s *TrafficSplits) List() []TrafficSplit {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	splits := make([]TrafficSplit, 0, len(s.splits))
+	for _, split := range s.splits {
+		splits = append(splits, split)
+	}
+
+	sort.Slice(splits, func(i, j int) bool {
+		return splits[i].Function < splits[j].Function
+	})
+
+	return splits
+}
+
+// WithTrafficSplits applies the traffic splits set through the /system/traffic API.
+func WithTrafficSplits(splits *TrafficSplits) Option {
+	return func(p *functionProxy) {
+		p.trafficSplits = splits
+	}
+}
+
+// NewTrafficHandlerFunc creates a http.HandlerFunc for the /system/traffic API.
+//
+//   - GET lists the traffic splits
+//   - PUT or POST sets the TrafficSplit in the body
+//   - DELETE removes the split for the function in the "function" query parameter
+//
+// Note that this will panic if `splits` is nil.
+func NewTrafficHandlerFunc(splits *TrafficSplits) http.HandlerFunc {
+	if splits == nil {
+		panic("NewTrafficHandlerFunc: empty traffic splits, cannot be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, splits.List())
+
+		case http.MethodPut, http.MethodPost:
+			var split TrafficSplit
+			if err := json.NewDecoder(r.Body).Decode(&split); err != nil {
+				fhttputil.Errorf(w, http.StatusBadRequest, "Unable to unmarshal traffic split: %s", err)
+				return
+			}
+
+			if err := splits.Set(split); err != nil {
+				fhttputil.Errorf(w, http.StatusBadRequest, "Invalid traffic split: %s", err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, split)
+
+		case http.MethodDelete:
+			functionName := r.URL.Query().Get("function")
+			if functionName == "" {
+				fhttputil.Errorf(w, http.StatusBadRequest, "Provide the function in the query string")
+				return
+			}
+
+			if !splits.Delete(functionName) {
+				fhttputil.Errorf(w, http.StatusNotFound, "No traffic split for: %s", functionName)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		fhttputil.Errorf(w, http.StatusInternalServerError, "Unable to marshal response: %s", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// resolveTrafficSplit returns the split for a function from the API, or from the resolver
+// when it implements TrafficSplitResolver.
+func (p *functionProxy) resolveTrafficSplit(functionName string) *TrafficSplit {
+	if p.trafficSplits != nil {
+		if split, ok := p.trafficSplits.Get(functionName); ok {
+			return &split
+		}
+	}
+
+	splitResolver, ok := p.resolver.(TrafficSplitResolver)
+	if !ok {
+		return nil
+	}
+
+	split, err := splitResolver.ResolveTrafficSplit(functionName)
+	if err != nil {
+		p.logger.Error("traffic split resolver error", append(types.FunctionLogAttrs(functionName), "error", err.Error())...)
+		return nil
+	}
+
+	return split
+}
+
+// selectVariant picks the function which serves a request for functionName. The
+// VariantHeader or the cookie of a sticky split are used when they name a valid variant,
+// otherwise a variant is picked by weight. A cookie is returned when a sticky split picked
+// a new variant.
+func (p *functionProxy) selectVariant(r *http.Request, functionName string) (string, *http.Cookie) {
+	split := p.resolveTrafficSplit(functionName)
+	if split == nil || len(split.Variants) == 0 {
+		return functionName, nil
+	}
+
+	isVariant := func(name string) bool {
+		if name == functionName {
+			return true
+		}
+		for _, variant := range split.Variants {
+			if variant.Function == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	target := ""
+	var cookie *http.Cookie
+	cookieName := variantCookiePrefix + functionName
+
+	if name := r.Header.Get(VariantHeader); name != "" && isVariant(name) {
+		target = name
+	} else if c, err := r.Cookie(cookieName); err == nil && split.Sticky && isVariant(c.Value) {
+		target = c.Value
+	} else {
+		target = pickVariant(functionName, split.Variants, rand.Intn(100))
+
+		if split.Sticky {
+			cookie = &http.Cookie{
+				Name:     cookieName,
+				Value:    target,
+				Path:     "/",
+				HttpOnly: true,
+			}
+		}
+	}
+
+	recordTrafficSplit(functionName, target)
+	return target, cookie
+}
+
+// pickVariant returns the variant for n, a number from 0 to 99.
+func pickVariant(functionName string, variants []TrafficVariant, n int) string {
+	for _, variant := range variants {
+		if n < variant.Weight {
+			return variant.Function
+		}
+		n -= variant.Weight
+	}
+
+	return functionName
+}
+
+// addVariantCookie sets the cookie of a sticky traffic split on the response.
+func addVariantCookie(header http.Header, cookie *http.Cookie) {
+	if cookie != nil {
+		header.Add("Set-Cookie", cookie.String())
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// trafficResolver resolves each function to its own test server.
+type trafficResolver struct {
+	hosts map[string]string
+	split *TrafficSplit
+}
+
+func (tr *trafficResolver) Resolve(name string) (url.URL, error) {
+	return url.URL{Scheme: "http", Host: tr.hosts[name]}, nil
+}
+
+func (tr *trafficResolver) ResolveTrafficSplit(name string) (*TrafficSplit, error) {
+	if tr.split != nil && tr.split.Function == name {
+		return tr.split, nil
+	}
+	return nil, nil
+}
+
+func newVariantServer(t *testing.T, name string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func Test_TrafficSplitFromAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        *TrafficSplit
+		wantErr     bool
+	}{
+		{name: "no split", annotations: map[string]string{}, want: nil},
+		{
+			name:        "canary",
+			annotations: map[string]string{TrafficSplitAnnotation: "foo-canary=10"},
+			want:        &TrafficSplit{Function: "foo", Variants: []TrafficVariant{{Function: "foo-canary", Weight: 10}}},
+		},
+		{
+			name:        "sticky with two variants",
+			annotations: map[string]string{TrafficSplitAnnotation: "foo-a=20, foo-b=30", TrafficStickyAnnotation: "true"},
+			want:        &TrafficSplit{Function: "foo", Sticky: true, Variants: []TrafficVariant{{Function: "foo-a", Weight: 20}, {Function: "foo-b", Weight: 30}}},
+		},
+		{name: "missing weight", annotations: map[string]string{TrafficSplitAnnotation: "foo-canary"}, wantErr: true},
+		{name: "over 100", annotations: map[string]string{TrafficSplitAnnotation: "foo-a=60,foo-b=50"}, wantErr: true},
+		{name: "self", annotations: map[string]string{TrafficSplitAnnotation: "foo=10"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := TrafficSplitFromAnnotations("foo", tc.annotations)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got %s", err)
+			}
+
+			if (got == nil) != (tc.want == nil) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+			if got == nil {
+				return
+			}
+
+			if got.Function != tc.want.Function || got.Sticky != tc.want.Sticky || len(got.Variants) != len(tc.want.Variants) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+			for i := range got.Variants {
+				if got.Variants[i] != tc.want.Variants[i] {
+					t.Errorf("want variant %v, got %v", tc.want.Variants[i], got.Variants[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_pickVariant(t *testing.T) {
+	variants := []TrafficVariant{{Function: "foo-a", Weight: 10}, {Function: "foo-b", Weight: 20}}
+
+	cases := map[int]string{0: "foo-a", 9: "foo-a", 10: "foo-b", 29: "foo-b", 30: "foo", 99: "foo"}
+	for n, want := range cases {
+		if got := pickVariant("foo", variants, n); got != want {
+			t.Errorf("want %s for %d, got %s", want, n, got)
+		}
+	}
+}
+
+func Test_ProxyHandler_TrafficSplit(t *testing.T) {
+	resolver := &trafficResolver{
+		hosts: map[string]string{
+			"foo":        newVariantServer(t, "foo"),
+			"foo-canary": newVariantServer(t, "foo-canary"),
+		},
+		split: &TrafficSplit{Function: "foo", Variants: []TrafficVariant{{Function: "foo-canary", Weight: 100}}, Sticky: true},
+	}
+
+	splits := NewTrafficSplits()
+	proxyFunc := NewHandlerFunc(types.FaaSConfig{ReadTimeout: 5 * time.Second}, resolver, false, WithTrafficSplits(splits))
+
+	invoke := func(setup func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://gateway/function/foo", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+		if setup != nil {
+			setup(req)
+		}
+
+		w := httptest.NewRecorder()
+		proxyFunc(w, req)
+		return w
+	}
+
+	w := invoke(nil)
+	if got := w.Body.String(); got != "foo-canary" {
+		t.Errorf("want the canary to serve all traffic, got %s", got)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "foo-canary" {
+		t.Fatalf("want a sticky cookie for foo-canary, got %v", cookies)
+	}
+
+	w = invoke(func(r *http.Request) { r.Header.Set(VariantHeader, "foo") })
+	if got := w.Body.String(); got != "foo" {
+		t.Errorf("want the variant header to select foo, got %s", got)
+	}
+
+	// A split from the API takes precedence over the resolver.
+	if err := splits.Set(TrafficSplit{Function: "foo", Variants: []TrafficVariant{{Function: "foo-canary", Weight: 0}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w = invoke(func(r *http.Request) { r.AddCookie(cookies[0]) })
+	if got := w.Body.String(); got != "foo" {
+		t.Errorf("want the API split to send all traffic to foo, got %s", got)
+	}
+}
+
+func Test_NewTrafficHandlerFunc(t *testing.T) {
+	splits := NewTrafficSplits()
+	handler := NewTrafficHandlerFunc(splits)
+
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "invalid split", method: http.MethodPut, target: "/system/traffic", body: `{"function":"foo","variants":[{"function":"foo-canary","weight":101}]}`, wantStatus: http.StatusBadRequest},
+		{name: "set split", method: http.MethodPut, target: "/system/traffic", body: `{"function":"foo","variants":[{"function":"foo-canary","weight":10}]}`, wantStatus: http.StatusOK},
+		{name: "list splits", method: http.MethodGet, target: "/system/traffic", wantStatus: http.StatusOK, wantBody: `[{"function":"foo","variants":[{"function":"foo-canary","weight":10}]}]`},
+		{name: "delete split", method: http.MethodDelete, target: "/system/traffic?function=foo", wantStatus: http.StatusOK},
+		{name: "delete missing split", method: http.MethodDelete, target: "/system/traffic?function=foo", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(tc.method, "http://gateway"+tc.target, strings.NewReader(tc.body)))
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("want status code %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("want body %s, got %s", tc.wantBody, w.Body.String())
+			}
+		})
+	}
+}
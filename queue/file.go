@@ -0,0 +1,604 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// SyncPolicy controls when writes to the write-ahead log are flushed to disk with fsync.
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes each record before Queue returns, so that no accepted
+	// request can be lost.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncInterval flushes records every SyncInterval, requests accepted since the
+	// last flush can be lost if the machine crashes.
+	SyncInterval SyncPolicy = "interval"
+
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	walFileName        = "queue.wal"
+	deadLetterFileName = "dead-letter.jsonl"
+
+	defaultSyncInterval     = time.Second
+	defaultCompactThreshold = 1000
+	metricsInterval         = 5 * time.Second
+
+	opEnqueue = "enqueue"
+	opAttempt = "attempt"
+	opAck     = "ack"
+)
+
+// ErrQueueClosed is returned by Queue after Close has been called.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// FileQueueConfig configures where a FileQueue stores requests, along with
+// how they are invoked.
+type FileQueueConfig struct {
+	MemoryQueueConfig
+
+	// Dir holds the write-ahead log and dead-letter storage, it is created if it
+	// does not exist.
+	Dir string
+
+	// Name is used for the "queue" label of the metrics, with a default of the
+	// base name of Dir.
+	Name string
+
+	// Sync is the SyncPolicy for the write-ahead log, with a default of SyncAlways.
+	Sync SyncPolicy
+
+	// SyncInterval is how often the log is flushed with SyncInterval, with a default of 1s.
+	SyncInterval time.Duration
+
+	// CompactThreshold is the number of completed requests after which the log is
+	// rewritten to hold only the pending requests, with a default of 1000.
+	CompactThreshold int
+}
+
+// DeadLetter is a request which was not completed within MaxAttempts, either because
+// the function kept responding with 429, 502 or 503, or because it could not be invoked.
+type DeadLetter struct {
+	Request *types.QueueRequest `json:"request"`
+
+	// Attempts is the number of times the request was invoked.
+	Attempts int `json:"attempts"`
+
+	// StatusCode of the last attempt, when there was a response.
+	StatusCode int `json:"statusCode,omitempty"`
+
+	Enqueued time.Time `json:"enqueued"`
+	Failed   time.Time `json:"failed"`
+}
+
+// FileQueue is a RequestQueuer which records each request in a write-ahead log on local
+// disk before it is accepted, so that async requests survive a restart of single-node
+// installations. Requests are invoked in the same way as by the MemoryQueue.
+//
+// A request is acknowledged in the log once it has completed and its callback has been
+// posted. Requests without an acknowledgement are redelivered when the FileQueue is opened
+// again, so a request may be invoked more than once. Each attempt is recorded, and a request
+// which reaches MaxAttempts, including attempts interrupted by a crash, is moved to
+// dead-letter storage instead of being invoked again.
+type FileQueue struct {
+	config FileQueueConfig
+	memory *MemoryQueue
+
+	lock   sync.Mutex
+	wal    *os.File
+	nextID uint64
+	live   map[uint64]*walEntry
+	acked  int
+	dirty  bool
+}
+
+// walEntry is a request which has been recorded in the log and not acknowledged.
+type walEntry struct {
+	req      *types.QueueRequest
+	enqueued time.Time
+	attempts int
+}
+
+// walRecord is a single line of the write-ahead log.
+type walRecord struct {
+	Op       string              `json:"op"`
+	ID       uint64              `json:"id"`
+	Time     time.Time           `json:"time"`
+	Attempts int                 `json:"attempts,omitempty"`
+	Request  *types.QueueRequest `json:"request,omitempty"`
+}
+
+// NewFileQueue opens or creates the write-ahead log in config.Dir. Requests left in the
+// log by a previous process are queued again, or moved to dead-letter storage when they
+// have reached MaxAttempts. Call Start to begin processing requests and Close to release
+// the log.
+func NewFileQueue(config FileQueueConfig, invoker http.Handler) (*FileQueue, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("a directory is required for the queue")
+	}
+	if config.Name == "" {
+		config.Name = filepath.Base(config.Dir)
+	}
+	if config.Sync == "" {
+		config.Sync = SyncAlways
+	}
+	switch config.Sync {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("invalid sync policy: %s", config.Sync)
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = defaultSyncInterval
+	}
+	if config.CompactThreshold < 1 {
+		config.CompactThreshold = defaultCompactThreshold
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create queue directory: %w", err)
+	}
+
+	q := &FileQueue{
+		config: config,
+		memory: NewMemoryQueue(config.MemoryQueueConfig, invoker),
+		live:   make(map[uint64]*walEntry),
+	}
+	q.config.MemoryQueueConfig = q.memory.config
+	q.memory.hooks = queueHooks{
+		started:  q.started,
+		finished: q.finished,
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, id := range q.liveIDs() {
+		entry := q.live[id]
+		if entry.attempts >= q.config.MaxAttempts {
+			q.config.Logger.Warn("queued request reached the maximum attempts before restart", queueLogAttrs(entry.req, "queue", q.config.Name, "attempts", entry.attempts)...)
+			if err := q.deadLetter(entry, 0); err != nil {
+				return nil, err
+			}
+			delete(q.live, id)
+			continue
+		}
+
+		item := q.memory.newItem(entry.req)
+		item.id = id
+		item.attempts = entry.attempts
+		item.queued = entry.enqueued
+		q.memory.push(item, false)
+	}
+
+	// Start from a compacted log, which also discards any partially written record.
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	q.updateMetrics(time.Now())
+
+	return q, nil
+}
+
+// Queue records the request in the log and then adds it to the queue. ErrQueueFull is
+// returned when the QueueSize is reached.
+func (q *FileQueue) Queue(req *types.QueueRequest) error {
+	if q.memory.full() {
+		return ErrQueueFull
+	}
+
+	q.lock.Lock()
+	if q.wal == nil {
+		q.lock.Unlock()
+		return ErrQueueClosed
+	}
+
+	id := q.nextID
+	now := time.Now()
+	if err := q.append(walRecord{Op: opEnqueue, ID: id, Time: now, Request: req}); err != nil {
+		q.lock.Unlock()
+		return fmt.Errorf("unable to write queued request: %w", err)
+	}
+
+	q.nextID++
+	q.live[id] = &walEntry{req: req, enqueued: now}
+	q.updateMetrics(now)
+	q.lock.Unlock()
+
+	item := q.memory.newItem(req)
+	item.id = id
+	item.queued = now
+	return q.memory.push(item, false)
+}
+
+// Len returns the number of requests which have not completed, including those being invoked.
+func (q *FileQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.live)
+}
+
+// Start runs the workers until ctx is done, this function is blocking. Requests being
+// invoked when ctx is done are not acknowledged, and are redelivered when the queue is
+// opened again.
+func (q *FileQueue) Start(ctx context.Context) {
+	go q.maintain(ctx)
+
+	q.memory.Start(ctx)
+}
+
+// Close flushes and closes the log, it should be called after Start has returned.
+func (q *FileQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.wal == nil {
+		return nil
+	}
+
+	syncErr := q.wal.Sync()
+	closeErr := q.wal.Close()
+	q.wal = nil
+
+	if syncErr != nil {
+		return syncErr
+	}
+	return closeErr
+}
+
+// DeadLetters returns the requests in dead-letter storage, oldest first.
+func (q *FileQueue) DeadLetters() ([]DeadLetter, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(q.config.Dir, deadLetterFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var deadLetters []DeadLetter
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var deadLetter DeadLetter
+		if err := json.Unmarshal(line, &deadLetter); err != nil {
+			return nil, fmt.Errorf("unable to read dead-letter: %w", err)
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, nil
+}
+
+// started records an attempt before the request is invoked, so that a request which
+// crashes the process is not retried indefinitely.
+func (q *FileQueue) started(item *queueItem) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entry, ok := q.live[item.id]
+	if !ok {
+		return
+	}
+	entry.attempts = item.attempts
+
+	if err := q.append(walRecord{Op: opAttempt, ID: item.id, Time: time.Now()}); err != nil {
+		q.config.Logger.Error("error recording attempt", queueLogAttrs(item.req, "queue", q.config.Name, "error", err.Error())...)
+	}
+}
+
+// finished acknowledges the request, moving it to dead-letter storage first when it
+// did not complete.
+func (q *FileQueue) finished(item *queueItem, res *result) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entry, ok := q.live[item.id]
+	if !ok {
+		return
+	}
+
+	if res == nil || isRetryable(res.StatusCode) {
+		statusCode := 0
+		if res != nil {
+			statusCode = res.StatusCode
+		}
+
+		if err := q.deadLetter(entry, statusCode); err != nil {
+			// Leave the request in the log, it will be dead-lettered after a restart.
+			q.config.Logger.Error("error writing dead-letter", queueLogAttrs(item.req, "queue", q.config.Name, "error", err.Error())...)
+			return
+		}
+	}
+
+	if err := q.append(walRecord{Op: opAck, ID: item.id, Time: time.Now()}); err != nil {
+		q.config.Logger.Error("error acknowledging queued request", queueLogAttrs(item.req, "queue", q.config.Name, "error", err.Error())...)
+		return
+	}
+
+	delete(q.live, item.id)
+	q.acked++
+	q.updateMetrics(time.Now())
+
+	if q.acked >= q.config.CompactThreshold {
+		if err := q.compact(); err != nil {
+			q.config.Logger.Error("error compacting queue", "queue", q.config.Name, "error", err.Error())
+		}
+	}
+}
+
+// maintain flushes the log for the SyncInterval policy and refreshes the age metric
+// until ctx is done.
+func (q *FileQueue) maintain(ctx context.Context) {
+	syncTicker := time.NewTicker(q.config.SyncInterval)
+	defer syncTicker.Stop()
+
+	metricsTicker := time.NewTicker(metricsInterval)
+	defer metricsTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			if q.config.Sync != SyncInterval {
+				continue
+			}
+
+			q.lock.Lock()
+			if q.wal != nil && q.dirty {
+				if err := q.wal.Sync(); err != nil {
+					q.config.Logger.Error("error syncing queue", "queue", q.config.Name, "error", err.Error())
+				} else {
+					q.dirty = false
+				}
+			}
+			q.lock.Unlock()
+		case now := <-metricsTicker.C:
+			q.lock.Lock()
+			q.updateMetrics(now)
+			q.lock.Unlock()
+		}
+	}
+}
+
+// append writes a record to the log according to the SyncPolicy. The lock must be held.
+func (q *FileQueue) append(record walRecord) error {
+	if q.wal == nil {
+		return ErrQueueClosed
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.wal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if q.config.Sync == SyncAlways {
+		return q.wal.Sync()
+	}
+
+	q.dirty = true
+	return nil
+}
+
+// replay reads the log written by a previous process. A record which was only partly
+// written before a crash ends the replay, as it cannot have been acknowledged to the caller.
+// Any other invalid record is skipped, so that the records after it are still applied.
+func (q *FileQueue) replay() error {
+	f, err := os.Open(filepath.Join(q.config.Dir, walFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to open queue log: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				q.config.Logger.Warn("discarding incomplete record at the end of queue log", "queue", q.config.Name)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read queue log: %w", err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			q.config.Logger.Warn("skipping invalid record in queue log", "queue", q.config.Name, "error", err.Error())
+			continue
+		}
+
+		switch record.Op {
+		case opEnqueue:
+			q.live[record.ID] = &walEntry{
+				req:      record.Request,
+				enqueued: record.Time,
+				attempts: record.Attempts,
+			}
+		case opAttempt:
+			if entry, ok := q.live[record.ID]; ok {
+				entry.attempts++
+			}
+		case opAck:
+			delete(q.live, record.ID)
+		}
+
+		if record.ID >= q.nextID {
+			q.nextID = record.ID + 1
+		}
+	}
+}
+
+// compact rewrites the log with only the requests which have not been acknowledged, the
+// new log replaces the old one atomically. The lock must be held.
+func (q *FileQueue) compact() error {
+	path := filepath.Join(q.config.Dir, walFileName)
+	tmpPath := path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create queue log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, id := range q.liveIDs() {
+		entry := q.live[id]
+		line, err := json.Marshal(walRecord{
+			Op:       opEnqueue,
+			ID:       id,
+			Time:     entry.enqueued,
+			Attempts: entry.attempts,
+			Request:  entry.req,
+		})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+
+		writer.Write(append(line, '\n'))
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("unable to replace queue log: %w", err)
+	}
+	if err := syncDir(q.config.Dir); err != nil {
+		return err
+	}
+
+	wal, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open queue log: %w", err)
+	}
+
+	if q.wal != nil {
+		q.wal.Close()
+	}
+	q.wal = wal
+	q.acked = 0
+	q.dirty = false
+
+	return nil
+}
+
+// deadLetter appends the request to dead-letter storage, which is always flushed as it
+// happens rarely. The lock must be held.
+func (q *FileQueue) deadLetter(entry *walEntry, statusCode int) error {
+	line, err := json.Marshal(DeadLetter{
+		Request:    entry.req,
+		Attempts:   entry.attempts,
+		StatusCode: statusCode,
+		Enqueued:   entry.enqueued,
+		Failed:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(q.config.Dir, deadLetterFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	deadLetterTotal.WithLabelValues(q.config.Name, entry.req.Function).Inc()
+
+	return f.Close()
+}
+
+// liveIDs returns the IDs of the pending requests in the order they were queued. The
+// lock must be held.
+func (q *FileQueue) liveIDs() []uint64 {
+	ids := make([]uint64, 0, len(q.live))
+	for id := range q.live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// updateMetrics sets the depth and age of the oldest request. The lock must be held.
+func (q *FileQueue) updateMetrics(now time.Time) {
+	var oldest time.Time
+	for _, entry := range q.live {
+		if oldest.IsZero() || entry.enqueued.Before(oldest) {
+			oldest = entry.enqueued
+		}
+	}
+
+	age := 0.0
+	if !oldest.IsZero() {
+		age = now.Sub(oldest).Seconds()
+	}
+
+	queueDepth.WithLabelValues(q.config.Name).Set(float64(len(q.live)))
+	queueOldestAge.WithLabelValues(q.config.Name).Set(age)
+}
+
+// syncDir flushes a directory so that a rename within it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,286 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_NewFileQueue_InvalidSyncPolicy(t *testing.T) {
+	_, err := NewFileQueue(FileQueueConfig{Dir: t.TempDir(), Sync: "sometimes"}, http.NotFoundHandler())
+	if err == nil {
+		t.Fatal("want error for invalid sync policy")
+	}
+}
+
+func Test_FileQueue_RedeliversAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	q, err := NewFileQueue(FileQueueConfig{Dir: dir}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, callID := range []string{"call-1", "call-2"} {
+		err := q.Queue(&types.QueueRequest{
+			Function:    "echo",
+			Header:      http.Header{CallIDHeader: []string{callID}},
+			CallbackURL: callbackURL,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a restart before the requests were invoked.
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = NewFileQueue(FileQueueConfig{Dir: dir}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := q.Len(); got != 2 {
+		t.Fatalf("want 2 requests after restart, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Start(ctx)
+
+	callIDs := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-results:
+			callIDs[res.header.Get(CallIDHeader)] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for callback")
+		}
+	}
+
+	if !callIDs["call-1"] || !callIDs["call-2"] {
+		t.Errorf("want callbacks for call-1 and call-2, got %v", callIDs)
+	}
+
+	waitFor(t, func() bool { return q.Len() == 0 })
+	cancel()
+	q.Close()
+
+	q, err = NewFileQueue(FileQueueConfig{Dir: dir}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if got := q.Len(); got != 0 {
+		t.Errorf("want acknowledged requests to be removed, got %d", got)
+	}
+}
+
+func Test_FileQueue_DeadLettersAfterMaxAttempts(t *testing.T) {
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	q, err := NewFileQueue(FileQueueConfig{
+		Dir: t.TempDir(),
+		MemoryQueueConfig: MemoryQueueConfig{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+		},
+	}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	if err := q.Queue(&types.QueueRequest{Function: "echo", Header: http.Header{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return q.Len() == 0 })
+
+	deadLetters, err := q.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deadLetters) != 1 {
+		t.Fatalf("want 1 dead-letter, got %d", len(deadLetters))
+	}
+
+	if got := deadLetters[0]; got.Request.Function != "echo" || got.Attempts != 2 || got.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want dead-letter for echo with 2 attempts and status 503, got %s %d %d", got.Request.Function, got.Attempts, got.StatusCode)
+	}
+}
+
+func Test_FileQueue_DeadLettersInterruptedAttempts(t *testing.T) {
+	dir := t.TempDir()
+	config := FileQueueConfig{
+		Dir:               dir,
+		MemoryQueueConfig: MemoryQueueConfig{MaxAttempts: 1},
+	}
+
+	started := make(chan struct{})
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	q, err := NewFileQueue(config, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Start(ctx)
+		close(done)
+	}()
+
+	if err := q.Queue(&types.QueueRequest{Function: "crash", Header: http.Header{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+	cancel()
+	<-done
+	q.Close()
+
+	q, err = NewFileQueue(config, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if got := q.Len(); got != 0 {
+		t.Errorf("want no requests to be redelivered, got %d", got)
+	}
+
+	deadLetters, err := q.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deadLetters) != 1 || deadLetters[0].Request.Function != "crash" {
+		t.Errorf("want 1 dead-letter for crash, got %v", deadLetters)
+	}
+}
+
+func Test_FileQueue_CompactsLog(t *testing.T) {
+	dir := t.TempDir()
+
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {})
+
+	q, err := NewFileQueue(FileQueueConfig{Dir: dir, CompactThreshold: 1}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	for i := 0; i < 3; i++ {
+		if err := q.Queue(&types.QueueRequest{Function: "echo", Header: http.Header{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, func() bool { return q.Len() == 0 })
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 0 {
+		t.Errorf("want empty log after compaction, got %d bytes", info.Size())
+	}
+}
+
+func Test_FileQueue_DiscardsIncompleteRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	log := `{"op":"enqueue","id":0,"time":"2024-01-01T00:00:00Z","request":{"Function":"echo","Method":""}}
+{"op":"enqueue","id":1,"time":"2024-01-01T00:00:01Z","requ`
+
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(log), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewFileQueue(FileQueueConfig{Dir: dir}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if got := q.Len(); got != 1 {
+		t.Errorf("want 1 request, got %d", got)
+	}
+}
+
+func Test_FileQueue_SkipsInvalidRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	log := `{"op":"enqueue","id":0,"time":"2024-01-01T00:00:00Z","request":{"Function":"echo","Method":""}}
+{"op":"enqueue","id":1,"time":"2024-01-01T00:00:01Z","requ
+{"op":"ack","id":0,"time":"2024-01-01T00:00:02Z"}
+{"op":"enqueue","id":2,"time":"2024-01-01T00:00:03Z","request":{"Function":"echo","Method":""}}
+`
+
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(log), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewFileQueue(FileQueueConfig{Dir: dir}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	// The ack after the invalid record is applied, and the later enqueue is kept.
+	if got := q.Len(); got != 1 {
+		t.Errorf("want 1 request, got %d", got)
+	}
+
+	if _, ok := q.live[2]; !ok {
+		t.Errorf("want request 2 to be queued, got: %v", q.liveIDs())
+	}
+
+	if q.nextID != 3 {
+		t.Errorf("want next ID 3, got %d", q.nextID)
+	}
+}
@@ -0,0 +1,129 @@
+// Package queue provides the asynchronous invocation handler for OpenFaaS providers.
+//
+// Requests to /async-function/{name} are converted into a types.QueueRequest and published
+// with a types.RequestQueuer, which can be backed by NATS or any other queue. The caller
+// receives a 202 Accepted response with a new X-Call-Id header to correlate the result,
+// which is posted to the X-Callback-Url when one is given. Callers which cannot receive a callback
+// can poll /system/async/{callId} when the queue records calls in a StatusStore.
+package queue
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// CallIDHeader is returned to the caller and added to the QueueRequest to identify the
+	// invocation, it is always created by the provider.
+	CallIDHeader = httputil.CallIDHeader
+
+	// CorrelationIDHeader holds the caller's X-Call-Id or X-Request-Id, when one was given,
+	// so that the invocation can be correlated with the original request.
+	CorrelationIDHeader = "X-Correlation-Id"
+
+	// CallbackURLHeader is the optional URL to post the result of the invocation to.
+	CallbackURLHeader = "X-Callback-Url"
+)
+
+// NewHandlerFunc creates a http.HandlerFunc which publishes asynchronous invocations
+// with the queuer. Request bodies larger than the MaxRequestBodySize are rejected.
+//
+// Note that this will panic if `queuer` is nil.
+func NewHandlerFunc(config types.FaaSConfig, queuer types.RequestQueuer) http.HandlerFunc {
+	if queuer == nil {
+		panic("NewHandlerFunc: empty request queuer, cannot be nil")
+	}
+
+	logger := config.GetLogger()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		switch r.Method {
+		case http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodGet:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		pathVars := mux.Vars(r)
+		functionName := pathVars["name"]
+		if functionName == "" {
+			httputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			reader := io.Reader(r.Body)
+			if config.MaxRequestBodySize > 0 {
+				reader = http.MaxBytesReader(w, r.Body, config.MaxRequestBodySize)
+			}
+
+			var err error
+			body, err = io.ReadAll(reader)
+			if err != nil {
+				httputil.Errorf(w, http.StatusRequestEntityTooLarge, "Unable to read request body: %s", err)
+				return
+			}
+		}
+
+		// The call ID is created here rather than taken from the caller, as it identifies the
+		// invocation in the StatusStore. The caller's ID is kept to correlate the two.
+		callID, err := httputil.NewCallID()
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to create call ID: %s", err)
+			return
+		}
+		correlationID := httputil.CallerCallID(r)
+
+		req := &types.QueueRequest{
+			Function:    functionName,
+			Header:      r.Header.Clone(),
+			Host:        r.Host,
+			Body:        body,
+			Method:      r.Method,
+			Path:        "/" + pathVars["params"],
+			QueryString: r.URL.RawQuery,
+		}
+		req.Header.Set(CallIDHeader, callID)
+		req.Header.Set(httputil.RequestIDHeader, callID)
+		req.Header.Del(CorrelationIDHeader)
+		if correlationID != "" {
+			req.Header.Set(CorrelationIDHeader, correlationID)
+		}
+
+		if callbackURL := r.Header.Get(CallbackURLHeader); callbackURL != "" {
+			u, err := url.Parse(callbackURL)
+			if err != nil || !u.IsAbs() {
+				httputil.Errorf(w, http.StatusBadRequest, "Invalid %s: %s", CallbackURLHeader, callbackURL)
+				return
+			}
+			req.CallbackURL = u
+		}
+
+		if err := queuer.Queue(req); err != nil {
+			logger.Error("error queuing request", queueLogAttrs(req, "error", err.Error())...)
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to queue request for: %s.", functionName)
+			return
+		}
+
+		w.Header().Set(CallIDHeader, callID)
+		w.Header().Set(httputil.RequestIDHeader, callID)
+		if correlationID != "" {
+			w.Header().Set(CorrelationIDHeader, correlationID)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type fakeQueuer struct {
+	requests []*types.QueueRequest
+	err      error
+}
+
+func (q *fakeQueuer) Queue(req *types.QueueRequest) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	q.requests = append(q.requests, req)
+	return nil
+}
+
+func newTestRouter(handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/async-function/{name}", handler)
+	router.HandleFunc("/async-function/{name}/", handler)
+	router.HandleFunc("/async-function/{name}/{params:.*}", handler)
+	return router
+}
+
+func Test_NewHandlerFunc_QueuesRequest(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := newTestRouter(NewHandlerFunc(types.FaaSConfig{}, queuer))
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo/sub/path?code=1", strings.NewReader("hello"))
+	req.Header.Set("X-Source", "unit-test")
+	req.Header.Set(CallbackURLHeader, "http://receiver:8080/result")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	callID := w.Header().Get(CallIDHeader)
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(callID) {
+		t.Errorf("want a UUID for the call ID, got %q", callID)
+	}
+
+	if len(queuer.requests) != 1 {
+		t.Fatalf("want 1 queued request, got %d", len(queuer.requests))
+	}
+
+	got := queuer.requests[0]
+	if got.Function != "echo" {
+		t.Errorf("Function want: %s, got: %s", "echo", got.Function)
+	}
+	if got.Method != http.MethodPost {
+		t.Errorf("Method want: %s, got: %s", http.MethodPost, got.Method)
+	}
+	if got.Path != "/sub/path" {
+		t.Errorf("Path want: %s, got: %s", "/sub/path", got.Path)
+	}
+	if got.QueryString != "code=1" {
+		t.Errorf("QueryString want: %s, got: %s", "code=1", got.QueryString)
+	}
+	if string(got.Body) != "hello" {
+		t.Errorf("Body want: %s, got: %s", "hello", string(got.Body))
+	}
+	if got.Header.Get("X-Source") != "unit-test" {
+		t.Errorf("Header X-Source want: %s, got: %s", "unit-test", got.Header.Get("X-Source"))
+	}
+	if got.Header.Get(CallIDHeader) != callID {
+		t.Errorf("Header %s want: %s, got: %s", CallIDHeader, callID, got.Header.Get(CallIDHeader))
+	}
+	if got.CallbackURL == nil || got.CallbackURL.String() != "http://receiver:8080/result" {
+		t.Errorf("CallbackURL want: %s, got: %v", "http://receiver:8080/result", got.CallbackURL)
+	}
+}
+
+func Test_NewHandlerFunc_CorrelatesCallerID(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := newTestRouter(NewHandlerFunc(types.FaaSConfig{}, queuer))
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo", nil)
+	req.Header.Set(CallIDHeader, "caller-call-1")
+	req.Header.Set("X-Request-Id", "gateway-request-1")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	callID := w.Header().Get(CallIDHeader)
+	if callID == "" || callID == "caller-call-1" {
+		t.Errorf("want a new call ID for the invocation, got %q", callID)
+	}
+	if got := w.Header().Get(CorrelationIDHeader); got != "caller-call-1" {
+		t.Errorf("want the incoming ID as %s, got %q", CorrelationIDHeader, got)
+	}
+
+	if len(queuer.requests) != 1 {
+		t.Fatalf("want 1 queued request, got %d", len(queuer.requests))
+	}
+
+	got := queuer.requests[0].Header
+	if got.Get(CallIDHeader) != callID || got.Get("X-Request-Id") != callID {
+		t.Errorf("want call ID %s in the queued request, got %q and %q", callID, got.Get(CallIDHeader), got.Get("X-Request-Id"))
+	}
+	if got.Get(CorrelationIDHeader) != "caller-call-1" {
+		t.Errorf("want the incoming ID in the queued request, got %q", got.Get(CorrelationIDHeader))
+	}
+}
+
+func Test_NewHandlerFunc_ResponseHeaders(t *testing.T) {
+	cases := []struct {
+		name            string
+		header          http.Header
+		wantCorrelation string
+	}{
+		{name: "no caller ID", header: http.Header{}},
+		{name: "call ID", header: http.Header{CallIDHeader: []string{"caller-call-1"}}, wantCorrelation: "caller-call-1"},
+		{name: "request ID", header: http.Header{"X-Request-Id": []string{"gateway-request-1"}}, wantCorrelation: "gateway-request-1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			queuer := &fakeQueuer{}
+			router := newTestRouter(NewHandlerFunc(types.FaaSConfig{}, queuer))
+			router.Use(httputil.CallIDMiddleware)
+
+			req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo", nil)
+			req.Header = tc.header
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			callID := w.Header().Get(CallIDHeader)
+			if callID == "" || callID == tc.wantCorrelation {
+				t.Errorf("want a new call ID, got %q", callID)
+			}
+			if got := w.Header().Get("X-Request-Id"); got != callID {
+				t.Errorf("want X-Request-Id to match %s %q, got %q", CallIDHeader, callID, got)
+			}
+			if got := w.Header().Get(CorrelationIDHeader); got != tc.wantCorrelation {
+				t.Errorf("want %s %q, got %q", CorrelationIDHeader, tc.wantCorrelation, got)
+			}
+			if got := queuer.requests[0].Header.Get(CorrelationIDHeader); got != tc.wantCorrelation {
+				t.Errorf("want %s %q in the queued request, got %q", CorrelationIDHeader, tc.wantCorrelation, got)
+			}
+		})
+	}
+}
+
+func Test_NewHandlerFunc_InvalidCallbackURL(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := newTestRouter(NewHandlerFunc(types.FaaSConfig{}, queuer))
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo", nil)
+	req.Header.Set(CallbackURLHeader, "/relative")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if len(queuer.requests) != 0 {
+		t.Fatalf("want no queued requests, got %d", len(queuer.requests))
+	}
+}
+
+func Test_NewHandlerFunc_QueueError(t *testing.T) {
+	queuer := &fakeQueuer{err: errors.New("queue is full")}
+	router := newTestRouter(NewHandlerFunc(types.FaaSConfig{}, queuer))
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("want status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func Test_NewHandlerFunc_BodyTooLarge(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := newTestRouter(NewHandlerFunc(types.FaaSConfig{MaxRequestBodySize: 4}, queuer))
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/async-function/echo", strings.NewReader("hello"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("want status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
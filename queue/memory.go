@@ -0,0 +1,393 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// MaxConcurrencyAnnotation can be set in the Annotations of a QueueRequest to
+	// limit the concurrent invocations of its function.
+	MaxConcurrencyAnnotation = "com.openfaas.queue.max-concurrency"
+
+	defaultQueueSize       = 1000
+	defaultWorkers         = 10
+	defaultMaxAttempts     = 3
+	defaultInitialBackoff  = time.Second
+	defaultMaxBackoff      = 30 * time.Second
+	defaultCallbackTimeout = 10 * time.Second
+)
+
+// ErrQueueFull is returned by Queue when the maximum number of requests are waiting.
+var ErrQueueFull = errors.New("queue is full")
+
+// MemoryQueueConfig configures the size of the queue and how requests are invoked.
+type MemoryQueueConfig struct {
+	// QueueSize is the maximum number of requests waiting to be invoked, with a default of 1000.
+	QueueSize int
+
+	// Workers is the number of requests invoked concurrently, with a default of 10.
+	Workers int
+
+	// MaxConcurrencyPerFunction limits concurrent invocations of each function, it can
+	// be overridden with the MaxConcurrencyAnnotation. The default of 0 means no limit
+	// other than the number of Workers.
+	MaxConcurrencyPerFunction int
+
+	// MaxAttempts is the number of times a request is invoked when the function responds
+	// with 429, 502 or 503, with a default of 3.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, it is doubled for each attempt
+	// up to the MaxBackoff. The defaults are 1s and 30s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// CallbackTimeout is the timeout for posting the result to the CallbackURL, with a
+	// default of 10s.
+	CallbackTimeout time.Duration
+
+	// StatusStore optionally records the status and result of each call, so that it
+	// can be retrieved with NewStatusHandlerFunc.
+	StatusStore StatusStore
+
+	// CallbackSecret optionally signs the body of each callback with HMAC-SHA256, see
+	// ReadCallbackSecret.
+	CallbackSecret []byte
+
+	// Logger is used for errors invoking requests and posting callbacks, with a default
+	// of slog.Default().
+	Logger *slog.Logger
+}
+
+// MemoryQueue is a RequestQueuer which holds requests in memory and invokes them with a pool
+// of workers, it is intended for single-node installations which do not run NATS.
+//
+// Requests are lost if the process exits before they have been invoked.
+type MemoryQueue struct {
+	config  MemoryQueueConfig
+	invoker http.Handler
+	client  *http.Client
+
+	lock    sync.Mutex
+	pending []*queueItem
+	running map[string]int
+	notify  chan struct{}
+
+	hooks queueHooks
+}
+
+// queueHooks let another queue, such as the FileQueue, record the progress of each request.
+type queueHooks struct {
+	// started is called before each attempt to invoke the request.
+	started func(item *queueItem)
+
+	// finished is called once the request will not be retried, after the callback has
+	// been posted. res is nil when the function could not be invoked.
+	finished func(item *queueItem, res *result)
+}
+
+// queueItem is a request waiting to be invoked.
+type queueItem struct {
+	id             uint64
+	req            *types.QueueRequest
+	maxConcurrency int
+	attempts       int
+	notBefore      time.Time
+	queued         time.Time
+	started        time.Time
+}
+
+// NewMemoryQueue creates a MemoryQueue which invokes functions through invoker, usually
+// the router returned by bootstrap.Router(), or any other handler serving the /function/
+// routes. Call Start to begin processing requests.
+func NewMemoryQueue(config MemoryQueueConfig, invoker http.Handler) *MemoryQueue {
+	if config.QueueSize < 1 {
+		config.QueueSize = defaultQueueSize
+	}
+	if config.Workers < 1 {
+		config.Workers = defaultWorkers
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.CallbackTimeout <= 0 {
+		config.CallbackTimeout = defaultCallbackTimeout
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	return &MemoryQueue{
+		config:  config,
+		invoker: invoker,
+		client:  &http.Client{Timeout: config.CallbackTimeout},
+		running: make(map[string]int),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Queue adds the request to the queue, ErrQueueFull is returned when the QueueSize is reached.
+func (q *MemoryQueue) Queue(req *types.QueueRequest) error {
+	return q.push(q.newItem(req), true)
+}
+
+func (q *MemoryQueue) newItem(req *types.QueueRequest) *queueItem {
+	item := &queueItem{
+		req:            req,
+		maxConcurrency: q.config.MaxConcurrencyPerFunction,
+		queued:         time.Now(),
+	}
+
+	if value, ok := req.Annotations[MaxConcurrencyAnnotation]; ok {
+		if maxConcurrency, err := strconv.Atoi(value); err == nil && maxConcurrency > 0 {
+			item.maxConcurrency = maxConcurrency
+		}
+	}
+
+	return item
+}
+
+// push adds the item to the pending requests, when limit is false the QueueSize is
+// not enforced, so that requests recovered after a restart are not dropped.
+func (q *MemoryQueue) push(item *queueItem, limit bool) error {
+	q.lock.Lock()
+	if limit && len(q.pending) >= q.config.QueueSize {
+		q.lock.Unlock()
+		return ErrQueueFull
+	}
+
+	q.pending = append(q.pending, item)
+	q.wake()
+	q.lock.Unlock()
+
+	q.recordStatus(item, CallQueued, nil)
+
+	return nil
+}
+
+// full checks if the QueueSize has been reached.
+func (q *MemoryQueue) full() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.pending) >= q.config.QueueSize
+}
+
+// Len returns the number of requests waiting to be invoked, including those waiting to be retried.
+func (q *MemoryQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.pending)
+}
+
+// Start runs the workers until ctx is done, this function is blocking.
+func (q *MemoryQueue) Start(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for i := 0; i < q.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (q *MemoryQueue) work(ctx context.Context) {
+	for {
+		item, ok := q.next(ctx)
+		if !ok {
+			return
+		}
+
+		q.process(ctx, item)
+	}
+}
+
+// next blocks until a request can be invoked, or ctx is done.
+func (q *MemoryQueue) next(ctx context.Context) (*queueItem, bool) {
+	for {
+		q.lock.Lock()
+		item, wait := q.take(time.Now())
+		q.lock.Unlock()
+
+		if item != nil {
+			return item, true
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, false
+		case <-q.notify:
+		case <-expired:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// take removes the first request which is ready to be invoked and whose function is below
+// its concurrency limit. When there is none, it returns how long until a retry is due. The
+// lock must be held.
+func (q *MemoryQueue) take(now time.Time) (*queueItem, time.Duration) {
+	var wait time.Duration
+
+	for i, item := range q.pending {
+		if item.notBefore.After(now) {
+			if delay := item.notBefore.Sub(now); wait == 0 || delay < wait {
+				wait = delay
+			}
+			continue
+		}
+
+		if item.maxConcurrency > 0 && q.running[item.req.Function] >= item.maxConcurrency {
+			continue
+		}
+
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		q.running[item.req.Function]++
+
+		// Other workers may be able to take the remaining requests.
+		if len(q.pending) > 0 {
+			q.wake()
+		}
+
+		return item, 0
+	}
+
+	return nil, wait
+}
+
+// process invokes the request, and either schedules a retry or posts the result to the callback.
+// Requests interrupted when ctx is done are dropped.
+func (q *MemoryQueue) process(ctx context.Context, item *queueItem) {
+	item.attempts++
+	item.started = time.Now()
+	if q.hooks.started != nil {
+		q.hooks.started(item)
+	}
+	q.recordStatus(item, CallRunning, nil)
+
+	res, err := invoke(ctx, q.invoker, item.req)
+
+	q.lock.Lock()
+	q.running[item.req.Function]--
+	if q.running[item.req.Function] <= 0 {
+		delete(q.running, item.req.Function)
+	}
+
+	// The invocation was interrupted by shutdown, so it is not completed.
+	if ctx.Err() != nil {
+		q.lock.Unlock()
+		return
+	}
+
+	if err == nil && isRetryable(res.StatusCode) && item.attempts < q.config.MaxAttempts {
+		item.notBefore = time.Now().Add(retryDelay(item.attempts, q.config.InitialBackoff, q.config.MaxBackoff, res.Header))
+		q.pending = append(q.pending, item)
+		q.wake()
+		q.lock.Unlock()
+
+		q.recordStatus(item, CallQueued, res)
+		return
+	}
+
+	q.wake()
+	q.lock.Unlock()
+
+	if err != nil {
+		q.config.Logger.Error("error invoking queued request", queueLogAttrs(item.req, "error", err.Error())...)
+		res = nil
+	}
+
+	if res == nil || res.StatusCode >= http.StatusBadRequest {
+		q.recordStatus(item, CallFailed, res)
+	} else {
+		q.recordStatus(item, CallSucceeded, res)
+	}
+
+	if res != nil {
+		if err := postCallback(ctx, q.client, q.config.CallbackSecret, item.req, res); err != nil {
+			q.config.Logger.Error("error posting callback", queueLogAttrs(item.req, "error", err.Error())...)
+		}
+	}
+
+	if q.hooks.finished != nil {
+		q.hooks.finished(item, res)
+	}
+}
+
+// wake signals a waiting worker without blocking.
+func (q *MemoryQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// recordStatus updates the StatusStore, when one is configured, for requests with a call ID.
+func (q *MemoryQueue) recordStatus(item *queueItem, state CallState, res *result) {
+	if q.config.StatusStore == nil {
+		return
+	}
+
+	callID := item.req.Header.Get(CallIDHeader)
+	if callID == "" {
+		return
+	}
+
+	status := CallStatus{
+		CallID:   callID,
+		Function: item.req.Function,
+		State:    state,
+		Attempts: item.attempts,
+		QueuedAt: item.queued,
+	}
+
+	if !item.started.IsZero() {
+		started := item.started
+		status.StartedAt = &started
+	}
+
+	if state == CallSucceeded || state == CallFailed {
+		completed := time.Now()
+		status.CompletedAt = &completed
+	}
+
+	if res != nil {
+		status.StatusCode = res.StatusCode
+		status.DurationSeconds = res.Duration.Seconds()
+		status.ContentType = res.Header.Get("Content-Type")
+		status.Result = res.Body
+	}
+
+	q.config.StatusStore.Set(status)
+}
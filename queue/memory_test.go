@@ -0,0 +1,289 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func newFunctionRouter(handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}", handler)
+	router.HandleFunc("/function/{name}/", handler)
+	router.HandleFunc("/function/{name}/{params:.*}", handler)
+	return router
+}
+
+type callback struct {
+	header http.Header
+	body   string
+}
+
+func newCallbackServer(t *testing.T) (*httptest.Server, chan callback) {
+	results := make(chan callback, 10)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		results <- callback{header: r.Header, body: string(body)}
+	}))
+	t.Cleanup(svr.Close)
+
+	return svr, results
+}
+
+func Test_MemoryQueue_QueueFull(t *testing.T) {
+	q := NewMemoryQueue(MemoryQueueConfig{QueueSize: 1}, http.NotFoundHandler())
+
+	if err := q.Queue(&types.QueueRequest{Function: "echo"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := q.Queue(&types.QueueRequest{Function: "echo"}); err != ErrQueueFull {
+		t.Fatalf("want ErrQueueFull, got %v", err)
+	}
+}
+
+func Test_MemoryQueue_RetriesAndPostsCallback(t *testing.T) {
+	var calls int32
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(mux.Vars(r)["params"] + " " + string(body)))
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	q := NewMemoryQueue(MemoryQueueConfig{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	err := q.Queue(&types.QueueRequest{
+		Function:    "echo",
+		Method:      http.MethodPost,
+		Path:        "/sub/path",
+		Body:        []byte("hello"),
+		Header:      http.Header{CallIDHeader: []string{"call-1"}},
+		CallbackURL: callbackURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-results:
+		if res.body != "sub/path hello" {
+			t.Errorf("want callback body %q, got %q", "sub/path hello", res.body)
+		}
+		if got := res.header.Get("X-Function-Status"); got != "200" {
+			t.Errorf("want X-Function-Status 200, got %q", got)
+		}
+		if got := res.header.Get(CallIDHeader); got != "call-1" {
+			t.Errorf("want %s call-1, got %q", CallIDHeader, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("want 3 attempts, got %d", got)
+	}
+}
+
+func Test_MemoryQueue_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	q := NewMemoryQueue(MemoryQueueConfig{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+	}, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	q.Queue(&types.QueueRequest{Function: "echo", CallbackURL: callbackURL, Header: http.Header{}})
+
+	select {
+	case res := <-results:
+		if got := res.header.Get("X-Function-Status"); got != "429" {
+			t.Errorf("want X-Function-Status 429, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("want 2 attempts, got %d", got)
+	}
+}
+
+func Test_MemoryQueue_MaxConcurrencyPerFunction(t *testing.T) {
+	var lock sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		lock.Lock()
+		running[name]++
+		if running[name] > maxRunning[name] {
+			maxRunning[name] = running[name]
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		running[name]--
+		lock.Unlock()
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	q := NewMemoryQueue(MemoryQueueConfig{
+		Workers:                   4,
+		MaxConcurrencyPerFunction: 1,
+	}, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	requests := []*types.QueueRequest{
+		{Function: "a"},
+		{Function: "a"},
+		{Function: "a"},
+		{Function: "b", Annotations: map[string]string{MaxConcurrencyAnnotation: "2"}},
+		{Function: "b", Annotations: map[string]string{MaxConcurrencyAnnotation: "2"}},
+	}
+
+	for _, req := range requests {
+		req.Header = http.Header{}
+		req.CallbackURL = callbackURL
+		if err := q.Queue(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range requests {
+		select {
+		case <-results:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for callbacks")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if maxRunning["a"] != 1 {
+		t.Errorf("want at most 1 concurrent invocation of a, got %d", maxRunning["a"])
+	}
+
+	if maxRunning["b"] != 2 {
+		t.Errorf("want 2 concurrent invocations of b, got %d", maxRunning["b"])
+	}
+}
+
+func Test_retryDelay(t *testing.T) {
+	cases := []struct {
+		name    string
+		attempt int
+		header  http.Header
+		want    time.Duration
+	}{
+		{name: "first attempt", attempt: 1, header: http.Header{}, want: time.Second},
+		{name: "third attempt", attempt: 3, header: http.Header{}, want: 4 * time.Second},
+		{name: "capped", attempt: 10, header: http.Header{}, want: 10 * time.Second},
+		{name: "Retry-After", attempt: 1, header: http.Header{"Retry-After": []string{"5"}}, want: 5 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := retryDelay(tc.attempt, time.Second, 10*time.Second, tc.header)
+			if got != tc.want {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_MemoryQueue_SignsCallback(t *testing.T) {
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	secret := []byte("callback-secret")
+	q := NewMemoryQueue(MemoryQueueConfig{CallbackSecret: secret}, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	q.Queue(&types.QueueRequest{Function: "echo", CallbackURL: callbackURL, Header: http.Header{}})
+
+	select {
+	case res := <-results:
+		err := httputil.VerifySignature(res.header, []byte(res.body), secret, httputil.DefaultSignatureTolerance, time.Now())
+		if err != nil {
+			t.Errorf("want valid signature, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+}
+
+func Test_ReadCallbackSecret(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ReadCallbackSecret(dir); err == nil {
+		t.Fatal("want error when the secret does not exist")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, CallbackSecretName), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := ReadCallbackSecret(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(secret) != "secret" {
+		t.Errorf("want secret %q, got %q", "secret", secret)
+	}
+}
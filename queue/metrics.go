@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// queueDepth is the number of requests which have been queued and not yet completed,
+// including those which are being invoked.
+var queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "provider",
+	Name:      "queue_depth",
+	Help:      "Number of queued requests which have not completed.",
+}, []string{"queue"})
+
+// queueOldestAge is the age of the oldest request which has not completed.
+var queueOldestAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "provider",
+	Name:      "queue_oldest_age_seconds",
+	Help:      "Age in seconds of the oldest queued request which has not completed.",
+}, []string{"queue"})
+
+// deadLetterTotal counts requests moved to dead-letter storage partitioned by function name.
+var deadLetterTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "queue_dead_letter_total",
+	Help:      "Total number of queued requests moved to dead-letter storage.",
+}, []string{"queue", "function_name"})
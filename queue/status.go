@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+// CallState is the progress of an asynchronous invocation.
+type CallState string
+
+const (
+	// CallQueued is a call waiting to be invoked, including between retries.
+	CallQueued CallState = "queued"
+
+	// CallRunning is a call whose function is being invoked.
+	CallRunning CallState = "running"
+
+	// CallSucceeded is a call whose function responded with a status below 400.
+	CallSucceeded CallState = "succeeded"
+
+	// CallFailed is a call whose function responded with an error, or could not be invoked.
+	CallFailed CallState = "failed"
+)
+
+const (
+	defaultStatusTTL     = time.Hour
+	defaultMaxResultSize = 1024 * 1024
+	statusSweepInterval  = time.Minute
+)
+
+// CallStatus is the status of an asynchronous invocation, identified by its X-Call-Id.
+type CallStatus struct {
+	CallID   string    `json:"callId"`
+	Function string    `json:"function"`
+	State    CallState `json:"state"`
+
+	// Attempts is the number of times the function has been invoked.
+	Attempts int `json:"attempts"`
+
+	// StatusCode of the last attempt, when there was a response.
+	StatusCode int `json:"statusCode,omitempty"`
+
+	QueuedAt    time.Time  `json:"queuedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	// DurationSeconds is how long the last attempt took.
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+
+	// ContentType and Result are the response of the function, when the
+	// store keeps results.
+	ContentType string `json:"contentType,omitempty"`
+	Result      []byte `json:"result,omitempty"`
+
+	// ResultOmitted is set when the result was larger than the store allows.
+	ResultOmitted bool `json:"resultOmitted,omitempty"`
+}
+
+// StatusStore records the status of asynchronous invocations, so that callers which
+// cannot receive a callback can poll for the result with NewStatusHandlerFunc.
+//
+// NewMemoryStatusStore provides an in-memory implementation, which is set as the
+// StatusStore of a MemoryQueueConfig.
+type StatusStore interface {
+	// Get returns the status of the call, expired calls must not be returned.
+	Get(callID string) (*CallStatus, bool)
+
+	// Set replaces the status of the call.
+	Set(status CallStatus)
+}
+
+// NewStatusHandlerFunc creates a http.HandlerFunc which returns the status of the call
+// given in the {callId} path variable as JSON, for the /system/async/{callId} route.
+//
+// Note that this will panic if `store` is nil.
+func NewStatusHandlerFunc(store StatusStore) http.HandlerFunc {
+	if store == nil {
+		panic("NewStatusHandlerFunc: empty status store, cannot be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		callID := mux.Vars(r)["callId"]
+		if callID == "" {
+			httputil.Errorf(w, http.StatusBadRequest, "Provide call ID in the request path")
+			return
+		}
+
+		status, ok := store.Get(callID)
+		if !ok {
+			httputil.Errorf(w, http.StatusNotFound, "Call not found: %s", callID)
+			return
+		}
+
+		body, err := json.Marshal(status)
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to marshal status: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// MemoryStatusStoreConfig configures how long statuses and results are kept.
+type MemoryStatusStoreConfig struct {
+	// TTL is how long a status is kept after it was last updated, with a default of 1h.
+	TTL time.Duration
+
+	// StoreResults keeps the response body of each call.
+	StoreResults bool
+
+	// MaxResultSize is the largest response body which is kept, with a default of 1MB.
+	// The ResultOmitted field is set for larger responses.
+	MaxResultSize int
+}
+
+// MemoryStatusStore is an in-memory StatusStore, statuses are removed once their TTL expires.
+type MemoryStatusStore struct {
+	config MemoryStatusStoreConfig
+
+	lock      sync.Mutex
+	entries   map[string]*statusEntry
+	lastSweep time.Time
+}
+
+type statusEntry struct {
+	status  CallStatus
+	expires time.Time
+}
+
+// NewMemoryStatusStore creates an empty MemoryStatusStore.
+func NewMemoryStatusStore(config MemoryStatusStoreConfig) *MemoryStatusStore {
+	if config.TTL <= 0 {
+		config.TTL = defaultStatusTTL
+	}
+	if config.MaxResultSize <= 0 {
+		config.MaxResultSize = defaultMaxResultSize
+	}
+
+	return &MemoryStatusStore{
+		config:    config,
+		entries:   make(map[string]*statusEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStatusStore) Get(callID string) (*CallStatus, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[callID]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(s.entries, callID)
+		return nil, false
+	}
+
+	status := entry.status
+	return &status, true
+}
+
+func (s *MemoryStatusStore) Set(status CallStatus) {
+	if !s.config.StoreResults {
+		status.Result = nil
+	} else if len(status.Result) > s.config.MaxResultSize {
+		status.Result = nil
+		status.ResultOmitted = true
+	}
+
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.entries[status.CallID] = &statusEntry{
+		status:  status,
+		expires: now.Add(s.config.TTL),
+	}
+
+	if now.Sub(s.lastSweep) >= statusSweepInterval {
+		for callID, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, callID)
+			}
+		}
+		s.lastSweep = now
+	}
+}
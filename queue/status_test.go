@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func newStatusRouter(store StatusStore) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/system/async/{callId}", NewStatusHandlerFunc(store))
+	return router
+}
+
+func Test_NewStatusHandlerFunc(t *testing.T) {
+	store := NewMemoryStatusStore(MemoryStatusStoreConfig{StoreResults: true})
+	store.Set(CallStatus{
+		CallID:     "call-1",
+		Function:   "echo",
+		State:      CallSucceeded,
+		Attempts:   1,
+		StatusCode: http.StatusOK,
+		Result:     []byte("hello"),
+	})
+
+	cases := []struct {
+		name       string
+		method     string
+		callID     string
+		wantStatus int
+	}{
+		{name: "found", method: http.MethodGet, callID: "call-1", wantStatus: http.StatusOK},
+		{name: "not found", method: http.MethodGet, callID: "call-2", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPost, callID: "call-1", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://gateway/system/async/"+tc.callID, nil)
+			w := httptest.NewRecorder()
+			newStatusRouter(store).ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("want status code %d, got %d", tc.wantStatus, w.Code)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var status CallStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+
+			if status.State != CallSucceeded || string(status.Result) != "hello" {
+				t.Errorf("want succeeded with result hello, got %s with %q", status.State, status.Result)
+			}
+		})
+	}
+}
+
+func Test_MemoryStatusStore_Expires(t *testing.T) {
+	store := NewMemoryStatusStore(MemoryStatusStoreConfig{TTL: 10 * time.Millisecond})
+	store.Set(CallStatus{CallID: "call-1", State: CallQueued})
+
+	if _, ok := store.Get("call-1"); !ok {
+		t.Fatal("want status before the TTL expires")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := store.Get("call-1"); ok {
+		t.Error("want no status after the TTL expires")
+	}
+}
+
+func Test_MemoryStatusStore_Results(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      MemoryStatusStoreConfig
+		result      string
+		wantResult  string
+		wantOmitted bool
+	}{
+		{name: "results not stored", config: MemoryStatusStoreConfig{}, result: "hello", wantResult: ""},
+		{name: "result stored", config: MemoryStatusStoreConfig{StoreResults: true}, result: "hello", wantResult: "hello"},
+		{name: "result too large", config: MemoryStatusStoreConfig{StoreResults: true, MaxResultSize: 4}, result: "hello", wantOmitted: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMemoryStatusStore(tc.config)
+			store.Set(CallStatus{CallID: "call-1", Result: []byte(tc.result)})
+
+			status, _ := store.Get("call-1")
+			if string(status.Result) != tc.wantResult {
+				t.Errorf("want result %q, got %q", tc.wantResult, status.Result)
+			}
+			if status.ResultOmitted != tc.wantOmitted {
+				t.Errorf("want ResultOmitted %t, got %t", tc.wantOmitted, status.ResultOmitted)
+			}
+		})
+	}
+}
+
+func Test_MemoryQueue_RecordsStatus(t *testing.T) {
+	release := make(chan struct{})
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("done"))
+	})
+
+	callbackSvr, results := newCallbackServer(t)
+	callbackURL, _ := url.Parse(callbackSvr.URL)
+
+	store := NewMemoryStatusStore(MemoryStatusStoreConfig{StoreResults: true})
+	q := NewMemoryQueue(MemoryQueueConfig{StatusStore: store}, router)
+
+	err := q.Queue(&types.QueueRequest{
+		Function:    "echo",
+		Header:      http.Header{CallIDHeader: []string{"call-1"}},
+		CallbackURL: callbackURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, ok := store.Get("call-1"); !ok || status.State != CallQueued {
+		t.Fatalf("want queued status, got %v", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	waitFor(t, func() bool {
+		status, _ := store.Get("call-1")
+		return status.State == CallRunning
+	})
+
+	close(release)
+
+	select {
+	case <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+
+	status, _ := store.Get("call-1")
+	if status.State != CallSucceeded {
+		t.Errorf("want state %s, got %s", CallSucceeded, status.State)
+	}
+	if status.Attempts != 1 || status.StatusCode != http.StatusOK {
+		t.Errorf("want 1 attempt with status 200, got %d with %d", status.Attempts, status.StatusCode)
+	}
+	if status.StartedAt == nil || status.CompletedAt == nil {
+		t.Error("want started and completed times")
+	}
+	if string(status.Result) != "done" || status.ContentType != "text/plain" {
+		t.Errorf("want text/plain result done, got %s %q", status.ContentType, status.Result)
+	}
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// result is the outcome of invoking a function for a QueueRequest.
+type result struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Duration   time.Duration
+}
+
+// invoke replays the QueueRequest through the function proxy served by invoker,
+// which is expected to handle the /function/{name} routes.
+func invoke(ctx context.Context, invoker http.Handler, req *types.QueueRequest) (*result, error) {
+	u := url.URL{
+		Path:     "/function/" + req.Function + req.Path,
+		RawQuery: req.QueryString,
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Header != nil {
+		httpReq.Header = req.Header.Clone()
+	}
+	httpReq.Host = req.Host
+
+	start := time.Now()
+	rw := httputil.NewBufferedResponseWriter()
+	invoker.ServeHTTP(rw, httpReq)
+
+	return &result{
+		StatusCode: rw.Status(),
+		Header:     rw.Header(),
+		Body:       rw.Body(),
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// CallbackSecretName is the name of the secret, in the SecretMountPath, used to sign callbacks.
+const CallbackSecretName = "callback-signing-secret"
+
+// ReadCallbackSecret reads the secret for signing callbacks from the SecretMountPath, it is
+// set as the CallbackSecret of a MemoryQueueConfig. Receivers verify callbacks with
+// httputil.VerifyRequest.
+func ReadCallbackSecret(secretMountPath string) ([]byte, error) {
+	if len(secretMountPath) == 0 {
+		return nil, fmt.Errorf("invalid SecretMountPath specified for reading secrets")
+	}
+
+	secretPath := path.Join(secretMountPath, CallbackSecretName)
+	secret, err := os.ReadFile(secretPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s", secretPath)
+	}
+
+	value := strings.TrimSpace(string(secret))
+	if value == "" {
+		return nil, fmt.Errorf("empty secret in %s", secretPath)
+	}
+
+	return []byte(value), nil
+}
+
+// postCallback sends the result of the invocation to the CallbackURL of the request, the
+// timestamp, call ID, status and body are signed when a secret is given.
+func postCallback(ctx context.Context, client *http.Client, secret []byte, req *types.QueueRequest, res *result) error {
+	if req.CallbackURL == nil {
+		return nil
+	}
+
+	callbackReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.CallbackURL.String(), bytes.NewReader(res.Body))
+	if err != nil {
+		return err
+	}
+
+	if contentType := res.Header.Get("Content-Type"); contentType != "" {
+		callbackReq.Header.Set("Content-Type", contentType)
+	}
+
+	callbackReq.Header.Set(CallIDHeader, req.Header.Get(CallIDHeader))
+	if correlationID := req.Header.Get(CorrelationIDHeader); correlationID != "" {
+		callbackReq.Header.Set(CorrelationIDHeader, correlationID)
+	}
+	callbackReq.Header.Set("X-Function-Name", req.Function)
+	callbackReq.Header.Set(httputil.FunctionStatusHeader, strconv.Itoa(res.StatusCode))
+	callbackReq.Header.Set("X-Duration-Seconds", fmt.Sprintf("%f", res.Duration.Seconds()))
+
+	if len(secret) > 0 {
+		httputil.SetSignature(callbackReq.Header, secret, time.Now(), res.Body)
+	}
+
+	callbackRes, err := client.Do(callbackReq)
+	if err != nil {
+		return err
+	}
+	defer callbackRes.Body.Close()
+
+	if callbackRes.StatusCode < 200 || callbackRes.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code from callback: %d", callbackRes.StatusCode)
+	}
+
+	return nil
+}
+
+// isRetryable checks for the status codes given when a function is overloaded
+// or has no replicas available.
+func isRetryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable:
+		return true
+	}
+
+	return false
+}
+
+// retryDelay doubles the initial backoff for each attempt up to the maximum, a
+// Retry-After header given in seconds by the function is used when it is larger.
+func retryDelay(attempt int, initial, max time.Duration, header http.Header) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		if retryAfter := time.Duration(seconds) * time.Second; retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// queueLogAttrs returns the fields logged for a queued request, followed by args.
+func queueLogAttrs(req *types.QueueRequest, args ...any) []any {
+	attrs := types.FunctionLogAttrs(req.Function)
+	if callID := req.Header.Get(CallIDHeader); callID != "" {
+		attrs = append(attrs, "call_id", callID)
+	}
+
+	return append(attrs, args...)
+}
@@ -0,0 +1,215 @@
+// Package revisions keeps a history of function deployments so that a bad deployment can
+// be rolled back.
+//
+// Record decorates the DeployFunction and UpdateFunction handlers to add each successful
+// deployment to a types.RevisionStore. The revisions of a function are listed at
+// /system/function/{name}/revisions, and /system/function/{name}/rollback applies an
+// earlier revision through the update handler, which records it as a new revision.
+package revisions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// OperationDeploy is a revision created by the DeployFunction handler.
+	OperationDeploy = "deploy"
+
+	// OperationUpdate is a revision created by the UpdateFunction handler.
+	OperationUpdate = "update"
+
+	// OperationRollback is a revision which restored an earlier revision.
+	OperationRollback = "rollback"
+)
+
+// RollbackRequest selects the revision to restore, the previous revision is used when
+// Revision is zero.
+type RollbackRequest struct {
+	Revision int `json:"revision,omitempty"`
+}
+
+// rollbackKey is the context key for the revision being restored by a rollback.
+type rollbackKey struct{}
+
+// Record decorates the DeployFunction or UpdateFunction handler, adding the deployment to
+// the store when the handler responds with a 2xx status. operation is OperationDeploy or
+// OperationUpdate. Errors from the store are written to logger, or slog.Default() when nil.
+func Record(next http.HandlerFunc, store types.RevisionStore, operation string, logger *slog.Logger) http.HandlerFunc {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				httputil.Errorf(w, http.StatusBadRequest, "Unable to read request body: %s", err)
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ww := httputil.NewHttpWriteInterceptor(w)
+		next(ww, r)
+
+		if ww.Status() < http.StatusOK || ww.Status() >= http.StatusMultipleChoices {
+			return
+		}
+
+		var deployment types.FunctionDeployment
+		if err := json.Unmarshal(body, &deployment); err != nil || deployment.Service == "" {
+			return
+		}
+
+		revision := types.FunctionRevision{
+			Operation:  operation,
+			Created:    time.Now(),
+			Deployment: deployment,
+		}
+
+		if rollbackOf, ok := r.Context().Value(rollbackKey{}).(int); ok {
+			revision.Operation = OperationRollback
+			revision.RollbackOf = rollbackOf
+		}
+
+		if _, err := store.Add(revision); err != nil {
+			logger.Error("error recording revision", "function", deployment.Service, "namespace", deployment.Namespace, "error", err.Error())
+		}
+	}
+}
+
+// NewListHandlerFunc creates a http.HandlerFunc which returns the revisions of the function
+// in the {name} path variable, newest first. The namespace is read from the query string.
+//
+// Note that this will panic if `store` is nil.
+func NewListHandlerFunc(store types.RevisionStore) http.HandlerFunc {
+	if store == nil {
+		panic("NewListHandlerFunc: empty revision store, cannot be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+		namespace := r.URL.Query().Get("namespace")
+
+		revisions, err := store.List(namespace, functionName)
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to list revisions for: %s, %s", functionName, err)
+			return
+		}
+
+		if revisions == nil {
+			revisions = []types.FunctionRevision{}
+		}
+
+		body, err := json.Marshal(revisions)
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to marshal revisions: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// NewRollbackHandlerFunc creates a http.HandlerFunc which restores a revision of the function
+// in the {name} path variable by calling update, the UpdateFunction handler decorated with
+// Record, so that the rollback is recorded as a new revision.
+//
+// Note that this will panic if `store` or `update` is nil.
+func NewRollbackHandlerFunc(store types.RevisionStore, update http.HandlerFunc) http.HandlerFunc {
+	if store == nil {
+		panic("NewRollbackHandlerFunc: empty revision store, cannot be nil")
+	}
+	if update == nil {
+		panic("NewRollbackHandlerFunc: empty update handler, cannot be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		functionName := mux.Vars(r)["name"]
+		namespace := r.URL.Query().Get("namespace")
+
+		var rollback RollbackRequest
+		if r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				httputil.Errorf(w, http.StatusBadRequest, "Unable to read request body: %s", err)
+				return
+			}
+			if len(bytes.TrimSpace(body)) > 0 {
+				if err := json.Unmarshal(body, &rollback); err != nil {
+					httputil.Errorf(w, http.StatusBadRequest, "Unable to unmarshal rollback request: %s", err)
+					return
+				}
+			}
+		}
+
+		revisions, err := store.List(namespace, functionName)
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to list revisions for: %s, %s", functionName, err)
+			return
+		}
+
+		target, ok := findRevision(revisions, rollback.Revision)
+		if !ok {
+			if rollback.Revision == 0 {
+				httputil.Errorf(w, http.StatusNotFound, "No previous revision for: %s", functionName)
+			} else {
+				httputil.Errorf(w, http.StatusNotFound, "Revision %d not found for: %s", rollback.Revision, functionName)
+			}
+			return
+		}
+
+		body, err := json.Marshal(target.Deployment)
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to marshal deployment: %s", err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), rollbackKey{}, target.Revision)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/system/functions", bytes.NewReader(body))
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to create update request: %s", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		update(w, req)
+	}
+}
+
+// findRevision returns the numbered revision, or the previous revision when number is zero.
+func findRevision(revisions []types.FunctionRevision, number int) (types.FunctionRevision, bool) {
+	if number == 0 {
+		if len(revisions) < 2 {
+			return types.FunctionRevision{}, false
+		}
+		return revisions[1], true
+	}
+
+	for _, revision := range revisions {
+		if revision.Revision == number {
+			return revision, true
+		}
+	}
+
+	return types.FunctionRevision{}, false
+}
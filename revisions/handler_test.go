@@ -0,0 +1,141 @@
+package revisions
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func newTestRouter(store types.RevisionStore, applied *[]string) *mux.Router {
+	apply := func(w http.ResponseWriter, r *http.Request) {
+		var deployment types.FunctionDeployment
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &deployment)
+		if deployment.Image == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*applied = append(*applied, deployment.Image)
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	deploy := Record(apply, store, OperationDeploy, nil)
+	update := Record(apply, store, OperationUpdate, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/functions", deploy).Methods(http.MethodPost)
+	router.HandleFunc("/system/functions", update).Methods(http.MethodPut)
+	router.HandleFunc("/system/function/{name}/revisions", NewListHandlerFunc(store)).Methods(http.MethodGet)
+	router.HandleFunc("/system/function/{name}/rollback", NewRollbackHandlerFunc(store, update)).Methods(http.MethodPost)
+	return router
+}
+
+func deploy(t *testing.T, router *mux.Router, method, image string) int {
+	body := `{"service":"fn","namespace":"openfaas-fn","image":"` + image + `"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, "http://gateway/system/functions", strings.NewReader(body)))
+	return w.Code
+}
+
+func listRevisions(t *testing.T, router *mux.Router) []types.FunctionRevision {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://gateway/system/function/fn/revisions?namespace=openfaas-fn", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var revisions []types.FunctionRevision
+	if err := json.Unmarshal(w.Body.Bytes(), &revisions); err != nil {
+		t.Fatal(err)
+	}
+	return revisions
+}
+
+func Test_Record_OnlySuccessfulDeployments(t *testing.T) {
+	var applied []string
+	router := newTestRouter(NewMemoryStore(0, "openfaas-fn"), &applied)
+
+	deploy(t, router, http.MethodPost, "fn:1")
+	deploy(t, router, http.MethodPut, "bad")
+	deploy(t, router, http.MethodPut, "fn:2")
+
+	revisions := listRevisions(t, router)
+	if len(revisions) != 2 {
+		t.Fatalf("want 2 revisions, got %d", len(revisions))
+	}
+
+	if revisions[0].Operation != OperationUpdate || revisions[0].Deployment.Image != "fn:2" {
+		t.Errorf("want update to fn:2, got %s to %s", revisions[0].Operation, revisions[0].Deployment.Image)
+	}
+	if revisions[1].Operation != OperationDeploy || revisions[1].Deployment.Image != "fn:1" {
+		t.Errorf("want deploy of fn:1, got %s of %s", revisions[1].Operation, revisions[1].Deployment.Image)
+	}
+}
+
+func Test_NewListHandlerFunc_EmptyList(t *testing.T) {
+	var applied []string
+	router := newTestRouter(NewMemoryStore(0, "openfaas-fn"), &applied)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://gateway/system/function/fn/revisions", nil))
+
+	if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+		t.Errorf("want an empty list, got %s", got)
+	}
+}
+
+func Test_NewRollbackHandlerFunc(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantImage  string
+		wantOf     int
+	}{
+		{name: "previous revision", body: "", wantStatus: http.StatusAccepted, wantImage: "fn:2", wantOf: 2},
+		{name: "numbered revision", body: `{"revision":1}`, wantStatus: http.StatusAccepted, wantImage: "fn:1", wantOf: 1},
+		{name: "unknown revision", body: `{"revision":7}`, wantStatus: http.StatusNotFound},
+		{name: "invalid body", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var applied []string
+			router := newTestRouter(NewMemoryStore(0, "openfaas-fn"), &applied)
+
+			deploy(t, router, http.MethodPost, "fn:1")
+			deploy(t, router, http.MethodPut, "fn:2")
+			deploy(t, router, http.MethodPut, "fn:3")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://gateway/system/function/fn/rollback?namespace=openfaas-fn", strings.NewReader(tc.body)))
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("want status code %d, got %d", tc.wantStatus, w.Code)
+			}
+
+			revisions := listRevisions(t, router)
+			if tc.wantImage == "" {
+				if len(revisions) != 3 {
+					t.Errorf("want no new revision, got %d revisions", len(revisions))
+				}
+				return
+			}
+
+			if got := applied[len(applied)-1]; got != tc.wantImage {
+				t.Errorf("want %s to be applied, got %s", tc.wantImage, got)
+			}
+
+			latest := revisions[0]
+			if latest.Revision != 4 || latest.Operation != OperationRollback || latest.RollbackOf != tc.wantOf {
+				t.Errorf("want revision 4 as a rollback of %d, got %d as %s of %d", tc.wantOf, latest.Revision, latest.Operation, latest.RollbackOf)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package revisions
+
+import (
+	"sync"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+const defaultMaxRevisions = 10
+
+// MemoryStore is an in-memory types.RevisionStore, revisions are lost when the provider restarts.
+type MemoryStore struct {
+	maxRevisions     int
+	defaultNamespace string
+
+	lock      sync.Mutex
+	revisions map[string][]types.FunctionRevision
+	latest    map[string]int
+}
+
+// NewMemoryStore creates a MemoryStore which keeps up to maxRevisions for each function,
+// with a default of 10. Revisions with an empty namespace are stored under the provider's
+// defaultNamespace, so that they are listed with or without the namespace.
+func NewMemoryStore(maxRevisions int, defaultNamespace string) *MemoryStore {
+	if maxRevisions < 1 {
+		maxRevisions = defaultMaxRevisions
+	}
+
+	return &MemoryStore{
+		maxRevisions:     maxRevisions,
+		defaultNamespace: defaultNamespace,
+		revisions:        make(map[string][]types.FunctionRevision),
+		latest:           make(map[string]int),
+	}
+}
+
+func (s *MemoryStore) Add(revision types.FunctionRevision) (types.FunctionRevision, error) {
+	key := s.functionKey(revision.Deployment.Namespace, revision.Deployment.Service)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.latest[key]++
+	revision.Revision = s.latest[key]
+
+	revisions := append([]types.FunctionRevision{revision}, s.revisions[key]...)
+	if len(revisions) > s.maxRevisions {
+		revisions = revisions[:s.maxRevisions]
+	}
+	s.revisions[key] = revisions
+
+	return revision, nil
+}
+
+func (s *MemoryStore) List(namespace, functionName string) ([]types.FunctionRevision, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]types.FunctionRevision(nil), s.revisions[s.functionKey(namespace, functionName)]...), nil
+}
+
+func (s *MemoryStore) functionKey(namespace, functionName string) string {
+	if namespace == "" {
+		namespace = s.defaultNamespace
+	}
+
+	return namespace + "/" + functionName
+}
@@ -0,0 +1,54 @@
+package revisions
+
+import (
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_MemoryStore_KeepsNewestRevisions(t *testing.T) {
+	store := NewMemoryStore(2, "openfaas-fn")
+
+	for _, image := range []string{"fn:1", "fn:2", "fn:3"} {
+		store.Add(types.FunctionRevision{Deployment: types.FunctionDeployment{Service: "fn", Namespace: "openfaas-fn", Image: image}})
+	}
+	store.Add(types.FunctionRevision{Deployment: types.FunctionDeployment{Service: "other", Namespace: "openfaas-fn", Image: "other:1"}})
+
+	got, err := store.List("openfaas-fn", "fn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("want 2 revisions, got %d", len(got))
+	}
+	if got[0].Revision != 3 || got[0].Deployment.Image != "fn:3" {
+		t.Errorf("want revision 3 with fn:3 first, got %d with %s", got[0].Revision, got[0].Deployment.Image)
+	}
+	if got[1].Revision != 2 {
+		t.Errorf("want revision 2 second, got %d", got[1].Revision)
+	}
+
+	other, _ := store.List("openfaas-fn", "other")
+	if len(other) != 1 || other[0].Revision != 1 {
+		t.Errorf("want revisions to be numbered per function, got %v", other)
+	}
+}
+
+func Test_MemoryStore_DefaultNamespace(t *testing.T) {
+	store := NewMemoryStore(0, "openfaas-fn")
+
+	store.Add(types.FunctionRevision{Deployment: types.FunctionDeployment{Service: "fn", Image: "fn:1"}})
+	store.Add(types.FunctionRevision{Deployment: types.FunctionDeployment{Service: "fn", Namespace: "openfaas-fn", Image: "fn:2"}})
+
+	for _, namespace := range []string{"", "openfaas-fn"} {
+		got, err := store.List(namespace, "fn")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != 2 || got[0].Revision != 2 {
+			t.Errorf("want 2 revisions for namespace %q, got %v", namespace, got)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultSkipped = "skipped"
+	resultMissed  = "missed"
+)
+
+// runTotal counts scheduled runs partitioned by function name and result, runs skipped by
+// the OverlapSkip policy and runs missed while the scheduler was stopped are included.
+var runTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "schedule_run_total",
+	Help:      "Total number of scheduled function runs.",
+}, []string{"function_name", "result"})
+
+// lastRunTime is the Unix time at which each schedule last started a run.
+var lastRunTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "provider",
+	Name:      "schedule_last_run_timestamp_seconds",
+	Help:      "Unix time of the last scheduled run of a function.",
+}, []string{"function_name"})
+
+// nextRunTime is the Unix time at which each schedule is next due.
+var nextRunTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "provider",
+	Name:      "schedule_next_run_timestamp_seconds",
+	Help:      "Unix time of the next scheduled run of a function.",
+}, []string{"function_name"})
+
+func recordRun(functionName string, result string) {
+	runTotal.WithLabelValues(functionName, result).Inc()
+}
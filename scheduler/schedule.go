@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openfaas/faas-provider/lister"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// ScheduleAnnotation is a standard five field cron expression, such as "*/5 * * * *",
+	// or a descriptor such as "@hourly", for when the function is invoked.
+	ScheduleAnnotation = "schedule"
+
+	// TimezoneAnnotation is the IANA timezone of the schedule, such as "Europe/London",
+	// with a default of UTC.
+	TimezoneAnnotation = "com.openfaas.schedule.timezone"
+
+	// OverlapAnnotation is the OverlapPolicy for when the previous run has not finished.
+	OverlapAnnotation = "com.openfaas.schedule.overlap"
+
+	// JitterAnnotation is the maximum random delay before each run, such as "30s", which
+	// spreads out functions sharing a schedule.
+	JitterAnnotation = "com.openfaas.schedule.jitter"
+
+	// MissedRunAnnotation is the MissedRunPolicy for runs missed while the scheduler was stopped.
+	MissedRunAnnotation = "com.openfaas.schedule.missed"
+)
+
+// OverlapPolicy decides what happens when a run is due before the previous run has finished.
+type OverlapPolicy string
+
+const (
+	// OverlapAllow starts the run alongside the previous one, this is the default.
+	OverlapAllow OverlapPolicy = "allow"
+
+	// OverlapSkip skips the run.
+	OverlapSkip OverlapPolicy = "skip"
+
+	// OverlapQueue starts the run once the previous one finishes, at most one run waits.
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// MissedRunPolicy decides what happens to runs which were due while the scheduler was
+// stopped, such as during a restart.
+type MissedRunPolicy string
+
+const (
+	// MissedRunSkip ignores missed runs, this is the default.
+	MissedRunSkip MissedRunPolicy = "skip"
+
+	// MissedRunOnce starts a single run when any runs were missed.
+	MissedRunOnce MissedRunPolicy = "run-once"
+)
+
+// job is the schedule of a function read from its annotations.
+type job struct {
+	function string
+	spec     string
+	schedule cron.Schedule
+	overlap  OverlapPolicy
+	jitter   time.Duration
+	missed   MissedRunPolicy
+
+	// next is when the function is due to run.
+	next time.Time
+
+	// runs is shared with the job which replaces this one when the annotations change, so
+	// that the OverlapPolicy applies to runs which are already in progress.
+	*runs
+}
+
+// runs is the state of a job's runs, it is guarded by the Scheduler's lock.
+type runs struct {
+	// running is the number of runs in progress, pending is set when a run is
+	// waiting for them with OverlapQueue.
+	running int
+	pending bool
+}
+
+// jobFromFunction reads the schedule from the function's annotations, nil is returned
+// for functions without the ScheduleAnnotation.
+func jobFromFunction(fn types.FunctionStatus) (*job, error) {
+	if fn.Annotations == nil {
+		return nil, nil
+	}
+	annotations := *fn.Annotations
+
+	expression, ok := annotations[ScheduleAnnotation]
+	if !ok || expression == "" {
+		return nil, nil
+	}
+
+	spec := expression
+	if timezone := annotations[TimezoneAnnotation]; timezone != "" {
+		spec = "CRON_TZ=" + timezone + " " + expression
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %q, %w", spec, err)
+	}
+
+	j := &job{
+		function: lister.QualifiedName(fn),
+		spec:     spec,
+		schedule: schedule,
+		overlap:  OverlapAllow,
+		missed:   MissedRunSkip,
+		runs:     &runs{},
+	}
+
+	if value, ok := annotations[OverlapAnnotation]; ok {
+		switch policy := OverlapPolicy(value); policy {
+		case OverlapAllow, OverlapSkip, OverlapQueue:
+			j.overlap = policy
+		default:
+			return nil, fmt.Errorf("invalid value for %s: %s", OverlapAnnotation, value)
+		}
+	}
+
+	if value, ok := annotations[JitterAnnotation]; ok {
+		jitter, err := time.ParseDuration(value)
+		if err != nil || jitter < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", JitterAnnotation, value)
+		}
+		j.jitter = jitter
+	}
+
+	if value, ok := annotations[MissedRunAnnotation]; ok {
+		switch policy := MissedRunPolicy(value); policy {
+		case MissedRunSkip, MissedRunOnce:
+			j.missed = policy
+		default:
+			return nil, fmt.Errorf("invalid value for %s: %s", MissedRunAnnotation, value)
+		}
+	}
+
+	return j, nil
+}
+
+// sameSchedule checks if the annotations of the function are unchanged, so that the
+// state of the existing job can be kept.
+func (j *job) sameSchedule(other *job) bool {
+	return j.spec == other.spec &&
+		j.overlap == other.overlap &&
+		j.jitter == other.jitter &&
+		j.missed == other.missed
+}
+
+// missedRuns counts the runs due after last and up to now, stopping at limit.
+func missedRuns(schedule cron.Schedule, last, now time.Time, limit int) int {
+	count := 0
+	for next := schedule.Next(last); !next.IsZero() && !next.After(now) && count < limit; next = schedule.Next(next) {
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,439 @@
+// Package scheduler invokes functions on a schedule given in their annotations, replacing
+// the need for a separate cron-connector.
+//
+// Functions are discovered with a lister.FunctionLister and need the ScheduleAnnotation,
+// other annotations set the timezone, the OverlapPolicy, jitter and the MissedRunPolicy.
+// Runs are made through the function proxy, or published to a types.RequestQueuer so that
+// they are invoked asynchronously.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/lister"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// ScheduledTimeHeader is added to each run with the time it was due, in RFC3339 format.
+	ScheduledTimeHeader = "X-Scheduled-Time"
+
+	defaultRefreshInterval = 30 * time.Second
+	defaultInvokeTimeout   = time.Minute
+
+	// maxMissedRuns limits how many missed runs are counted for each schedule.
+	maxMissedRuns = 1000
+)
+
+// Config configures how functions are discovered and invoked.
+type Config struct {
+	// Namespaces to discover functions in, with a default of the provider's default namespace.
+	Namespaces []string
+
+	// RefreshInterval is how often the functions are listed, with a default of 30s.
+	RefreshInterval time.Duration
+
+	// InvokeTimeout limits each run made through the proxy, with a default of 1m.
+	InvokeTimeout time.Duration
+
+	// Queuer optionally publishes runs as asynchronous invocations instead of
+	// invoking the function through the proxy.
+	Queuer types.RequestQueuer
+
+	// StateFile records the last run of each schedule, so that runs missed while the
+	// scheduler was stopped can be found. Missed runs are not detected when it is empty.
+	StateFile string
+
+	// Logger is used for errors listing and invoking functions, with a default of slog.Default().
+	Logger *slog.Logger
+}
+
+// Scheduler invokes functions on the schedule given in their annotations.
+type Scheduler struct {
+	config  Config
+	lister  lister.FunctionLister
+	invoker http.Handler
+
+	lock  sync.Mutex
+	jobs  map[string]*job
+	state map[string]time.Time
+	wg    sync.WaitGroup
+
+	// stateLock serialises writes to the StateFile.
+	stateLock sync.Mutex
+}
+
+// New creates a Scheduler which discovers functions with lister and invokes them through
+// invoker, usually the router returned by bootstrap.Router(), or any other handler serving
+// the /function/ routes. Call Start to begin scheduling.
+//
+// Note that this will panic if `lister` or `invoker` is nil.
+func New(config Config, lister lister.FunctionLister, invoker http.Handler) *Scheduler {
+	if lister == nil {
+		panic("New: empty function lister, cannot be nil")
+	}
+	if invoker == nil && config.Queuer == nil {
+		panic("New: empty invoker, cannot be nil")
+	}
+
+	if len(config.Namespaces) == 0 {
+		config.Namespaces = []string{""}
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	if config.InvokeTimeout <= 0 {
+		config.InvokeTimeout = defaultInvokeTimeout
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	return &Scheduler{
+		config:  config,
+		lister:  lister,
+		invoker: invoker,
+		jobs:    make(map[string]*job),
+		state:   make(map[string]time.Time),
+	}
+}
+
+// Start schedules runs until ctx is done and then waits for runs in progress, this
+// function is blocking. An error is returned if the StateFile cannot be read.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if err := s.loadState(); err != nil {
+		return err
+	}
+
+	refreshTicker := time.NewTicker(s.config.RefreshInterval)
+	defer refreshTicker.Stop()
+
+	s.refresh(ctx, time.Now())
+
+	for {
+		wait := s.runDue(ctx, time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.wg.Wait()
+			return nil
+		case <-timer.C:
+		case now := <-refreshTicker.C:
+			timer.Stop()
+			s.refresh(ctx, now)
+		}
+	}
+}
+
+// refresh lists the functions and updates the jobs. Functions keep any runs in progress
+// when their annotations change, and keep their next run unless the schedule changed.
+// Missed runs are only found for schedules which were not already known.
+func (s *Scheduler) refresh(ctx context.Context, now time.Time) {
+	jobs := map[string]*job{}
+	for _, namespace := range s.config.Namespaces {
+		functions, err := s.lister.ListFunctions(ctx, namespace)
+		if err != nil {
+			// Keep the current jobs rather than stopping their schedules.
+			s.config.Logger.Error("error listing functions for schedules", "namespace", namespace, "error", err.Error())
+			return
+		}
+
+		for _, fn := range functions {
+			j, err := jobFromFunction(fn)
+			if err != nil {
+				s.config.Logger.Error("error reading schedule", append(types.FunctionLogAttrs(lister.QualifiedName(fn)), "error", err.Error())...)
+				continue
+			}
+			if j != nil {
+				jobs[j.function] = j
+			}
+		}
+	}
+
+	var missed []*job
+	saveState := false
+
+	s.lock.Lock()
+	for name, j := range jobs {
+		if existing, ok := s.jobs[name]; ok {
+			if existing.sameSchedule(j) {
+				jobs[name] = existing
+				continue
+			}
+
+			j.runs = existing.runs
+			if existing.spec == j.spec {
+				j.next = existing.next
+				continue
+			}
+
+			// An edited schedule starts from now, the runs of the previous schedule
+			// are not counted as missed.
+			j.next = j.schedule.Next(now)
+			s.state[name] = now
+			saveState = true
+			nextRunTime.WithLabelValues(name).Set(float64(j.next.Unix()))
+			continue
+		}
+
+		j.next = j.schedule.Next(now)
+
+		last, ok := s.state[name]
+		if !ok {
+			// Runs missed before the first run are found from when the schedule was seen.
+			s.state[name] = now
+			saveState = true
+		} else if count := missedRuns(j.schedule, last, now, maxMissedRuns); count > 0 {
+			s.config.Logger.Warn("schedule missed runs", append(types.FunctionLogAttrs(name), "missed", count)...)
+			runTotal.WithLabelValues(name, resultMissed).Add(float64(count))
+
+			if j.missed == MissedRunOnce {
+				missed = append(missed, j)
+			}
+		}
+
+		nextRunTime.WithLabelValues(name).Set(float64(j.next.Unix()))
+	}
+
+	for name := range s.jobs {
+		if _, ok := jobs[name]; !ok {
+			lastRunTime.DeleteLabelValues(name)
+			nextRunTime.DeleteLabelValues(name)
+		}
+	}
+
+	s.jobs = jobs
+	s.lock.Unlock()
+
+	if saveState {
+		if err := s.saveState(); err != nil {
+			s.config.Logger.Error("error saving schedule state", "error", err.Error())
+		}
+	}
+
+	for _, j := range missed {
+		s.start(ctx, j, now)
+	}
+}
+
+// runDue starts the jobs which are due and returns how long until the next one.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) time.Duration {
+	due := map[*job]time.Time{}
+	wait := s.config.RefreshInterval
+
+	s.lock.Lock()
+	for _, j := range s.jobs {
+		if !j.next.After(now) {
+			due[j] = j.next
+		}
+	}
+	s.lock.Unlock()
+
+	for j, scheduled := range due {
+		s.start(ctx, j, scheduled)
+	}
+
+	s.lock.Lock()
+	for _, j := range s.jobs {
+		if j.next.IsZero() {
+			continue
+		}
+		if delay := j.next.Sub(now); delay < wait {
+			wait = delay
+		}
+	}
+	s.lock.Unlock()
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+// start records the run and moves the job to its next time, then invokes the function
+// in the background according to the OverlapPolicy.
+func (s *Scheduler) start(ctx context.Context, j *job, scheduled time.Time) {
+	now := time.Now()
+
+	s.lock.Lock()
+	if next := j.schedule.Next(now); next.After(j.next) {
+		j.next = next
+		nextRunTime.WithLabelValues(j.function).Set(float64(next.Unix()))
+	}
+	s.state[j.function] = scheduled
+	s.lock.Unlock()
+
+	if err := s.saveState(); err != nil {
+		s.config.Logger.Error("error saving schedule state", "error", err.Error())
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, j, scheduled)
+	}()
+}
+
+// run applies the jitter and OverlapPolicy before invoking the function, then starts
+// a run which was queued behind it.
+func (s *Scheduler) run(ctx context.Context, j *job, scheduled time.Time) {
+	if j.jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(j.jitter)))):
+		}
+	}
+
+	s.lock.Lock()
+	if j.running > 0 {
+		switch j.overlap {
+		case OverlapSkip:
+			s.lock.Unlock()
+			s.config.Logger.Info("skipping scheduled run, previous run in progress", types.FunctionLogAttrs(j.function)...)
+			recordRun(j.function, resultSkipped)
+			return
+		case OverlapQueue:
+			if j.pending {
+				s.lock.Unlock()
+				recordRun(j.function, resultSkipped)
+				return
+			}
+			j.pending = true
+			s.lock.Unlock()
+			return
+		}
+	}
+	j.running++
+	s.lock.Unlock()
+
+	for {
+		lastRunTime.WithLabelValues(j.function).Set(float64(time.Now().Unix()))
+
+		if err := s.invoke(ctx, j.function, scheduled); err != nil {
+			s.config.Logger.Error("error in scheduled run", append(types.FunctionLogAttrs(j.function), "error", err.Error())...)
+			recordRun(j.function, resultError)
+		} else {
+			recordRun(j.function, resultSuccess)
+		}
+
+		s.lock.Lock()
+		if j.pending && ctx.Err() == nil {
+			j.pending = false
+			s.lock.Unlock()
+			scheduled = time.Now()
+			continue
+		}
+		j.pending = false
+		j.running--
+		s.lock.Unlock()
+		return
+	}
+}
+
+// invoke publishes the run to the Queuer when one is configured, otherwise the function
+// is invoked through the proxy and a status of 400 or above is an error.
+func (s *Scheduler) invoke(ctx context.Context, functionName string, scheduled time.Time) error {
+	header := http.Header{}
+	header.Set(ScheduledTimeHeader, scheduled.UTC().Format(time.RFC3339))
+
+	if s.config.Queuer != nil {
+		return s.config.Queuer.Queue(&types.QueueRequest{
+			Function: functionName,
+			Method:   http.MethodPost,
+			Path:     "/",
+			Header:   header,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.InvokeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/function/"+functionName, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+
+	w := httputil.NewBufferedResponseWriter()
+	s.invoker.ServeHTTP(w, req)
+
+	if w.Status() >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code: %d", w.Status())
+	}
+
+	return nil
+}
+
+// loadState reads the last run of each schedule from the StateFile.
+func (s *Scheduler) loadState() error {
+	if s.config.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.config.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to read schedule state: %w", err)
+	}
+
+	state := map[string]time.Time{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("unable to unmarshal schedule state: %w", err)
+	}
+
+	s.lock.Lock()
+	s.state = state
+	s.lock.Unlock()
+
+	return nil
+}
+
+// saveState replaces the StateFile with the last run of each schedule.
+func (s *Scheduler) saveState() error {
+	if s.config.StateFile == "" {
+		return nil
+	}
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	s.lock.Lock()
+	data, err := json.Marshal(s.state)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.StateFile), filepath.Base(s.config.StateFile)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.config.StateFile)
+}
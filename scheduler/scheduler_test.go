@@ -0,0 +1,339 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type fakeLister struct {
+	lock      sync.Mutex
+	functions []types.FunctionStatus
+}
+
+func (l *fakeLister) ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.functions, nil
+}
+
+func scheduledFunction(name string, annotations map[string]string) types.FunctionStatus {
+	return types.FunctionStatus{Name: name, Annotations: &annotations}
+}
+
+func newFunctionRouter(handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}", handler)
+	return router
+}
+
+func Test_jobFromFunction(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantJob     bool
+		wantErr     bool
+		wantOverlap OverlapPolicy
+		wantJitter  time.Duration
+	}{
+		{name: "no schedule", annotations: map[string]string{}, wantJob: false},
+		{name: "defaults", annotations: map[string]string{ScheduleAnnotation: "*/5 * * * *"}, wantJob: true, wantOverlap: OverlapAllow},
+		{name: "descriptor", annotations: map[string]string{ScheduleAnnotation: "@hourly"}, wantJob: true, wantOverlap: OverlapAllow},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				ScheduleAnnotation:  "0 9 * * 1-5",
+				TimezoneAnnotation:  "Europe/London",
+				OverlapAnnotation:   "skip",
+				JitterAnnotation:    "30s",
+				MissedRunAnnotation: "run-once",
+			},
+			wantJob:     true,
+			wantOverlap: OverlapSkip,
+			wantJitter:  30 * time.Second,
+		},
+		{name: "invalid expression", annotations: map[string]string{ScheduleAnnotation: "every day"}, wantErr: true},
+		{name: "invalid timezone", annotations: map[string]string{ScheduleAnnotation: "@daily", TimezoneAnnotation: "Mars/Olympus"}, wantErr: true},
+		{name: "invalid overlap", annotations: map[string]string{ScheduleAnnotation: "@daily", OverlapAnnotation: "sometimes"}, wantErr: true},
+		{name: "invalid jitter", annotations: map[string]string{ScheduleAnnotation: "@daily", JitterAnnotation: "soon"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			j, err := jobFromFunction(scheduledFunction("report", tc.annotations))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if (j != nil) != tc.wantJob {
+				t.Fatalf("want job %t, got %v", tc.wantJob, j)
+			}
+			if j == nil {
+				return
+			}
+
+			if j.overlap != tc.wantOverlap {
+				t.Errorf("want overlap %s, got %s", tc.wantOverlap, j.overlap)
+			}
+			if j.jitter != tc.wantJitter {
+				t.Errorf("want jitter %s, got %s", tc.wantJitter, j.jitter)
+			}
+		})
+	}
+}
+
+func Test_jobFromFunction_Timezone(t *testing.T) {
+	j, err := jobFromFunction(scheduledFunction("report", map[string]string{
+		ScheduleAnnotation: "0 9 * * *",
+		TimezoneAnnotation: "America/New_York",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 1, 15, 14, 0, 0, 0, time.UTC)
+
+	if got := j.schedule.Next(from); !got.Equal(want) {
+		t.Errorf("want %s, got %s", want, got.UTC())
+	}
+}
+
+func Test_missedRuns(t *testing.T) {
+	j, _ := jobFromFunction(scheduledFunction("report", map[string]string{ScheduleAnnotation: "@hourly"}))
+
+	last := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{name: "none", now: last.Add(30 * time.Minute), want: 0},
+		{name: "one", now: last.Add(90 * time.Minute), want: 1},
+		{name: "several", now: last.Add(5 * time.Hour), want: 5},
+		{name: "limited", now: last.Add(48 * time.Hour), want: 10},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := missedRuns(j.schedule, last, tc.now, 10); got != tc.want {
+				t.Errorf("want %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_Scheduler_RunsFunction(t *testing.T) {
+	calls := make(chan *http.Request, 10)
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		calls <- r
+	})
+
+	lister := &fakeLister{functions: []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{ScheduleAnnotation: "@every 1s"}),
+		{Name: "unscheduled"},
+	}}
+
+	s := New(Config{}, lister, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx)
+
+	select {
+	case r := <-calls:
+		if mux.Vars(r)["name"] != "report" {
+			t.Errorf("want report to be invoked, got %s", mux.Vars(r)["name"])
+		}
+		if r.Header.Get(ScheduledTimeHeader) == "" {
+			t.Errorf("want %s header", ScheduledTimeHeader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for scheduled run")
+	}
+}
+
+func Test_Scheduler_OverlapPolicy(t *testing.T) {
+	cases := []struct {
+		name      string
+		overlap   OverlapPolicy
+		wantCalls int32
+	}{
+		{name: "allow", overlap: OverlapAllow, wantCalls: 3},
+		{name: "skip", overlap: OverlapSkip, wantCalls: 1},
+		{name: "queue", overlap: OverlapQueue, wantCalls: 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+
+			router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				started <- struct{}{}
+				<-release
+			})
+
+			j, err := jobFromFunction(scheduledFunction("report", map[string]string{
+				ScheduleAnnotation: "@hourly",
+				OverlapAnnotation:  string(tc.overlap),
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := New(Config{}, &fakeLister{}, router)
+			ctx := context.Background()
+
+			s.start(ctx, j, time.Now())
+			<-started
+
+			s.start(ctx, j, time.Now())
+			s.start(ctx, j, time.Now())
+
+			// Give the overlapping runs time to be started, skipped or queued.
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			s.wg.Wait()
+
+			if got := atomic.LoadInt32(&calls); got != tc.wantCalls {
+				t.Errorf("want %d calls, got %d", tc.wantCalls, got)
+			}
+		})
+	}
+}
+
+func Test_Scheduler_MissedRunOnce(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "schedule.json")
+
+	last := time.Now().Add(-3 * time.Hour)
+	data, _ := json.Marshal(map[string]time.Time{"report": last})
+	if err := os.WriteFile(stateFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan struct{}, 10)
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		calls <- struct{}{}
+	})
+
+	lister := &fakeLister{functions: []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{
+			ScheduleAnnotation:  "@hourly",
+			MissedRunAnnotation: string(MissedRunOnce),
+		}),
+	}}
+
+	s := New(Config{StateFile: stateFile}, lister, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for missed run")
+	}
+
+	cancel()
+
+	select {
+	case <-calls:
+		t.Error("want a single run for the missed runs")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_Scheduler_RefreshKeepsRuns(t *testing.T) {
+	lister := &fakeLister{functions: []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{
+			ScheduleAnnotation: "@hourly",
+			OverlapAnnotation:  string(OverlapSkip),
+		}),
+	}}
+
+	s := New(Config{}, lister, newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {}))
+	now := time.Now()
+
+	s.refresh(context.Background(), now)
+	previous := s.jobs["report"]
+	previous.running = 1
+
+	lister.functions = []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{
+			ScheduleAnnotation: "@hourly",
+			OverlapAnnotation:  string(OverlapSkip),
+			JitterAnnotation:   "1s",
+		}),
+	}
+	s.refresh(context.Background(), now.Add(time.Minute))
+
+	j := s.jobs["report"]
+	if j.jitter != time.Second {
+		t.Errorf("want jitter of 1s, got %s", j.jitter)
+	}
+	if j.running != 1 {
+		t.Errorf("want 1 run in progress, got %d", j.running)
+	}
+	if !j.next.Equal(previous.next) {
+		t.Errorf("want next run %s, got %s", previous.next, j.next)
+	}
+}
+
+func Test_Scheduler_RefreshEditedSchedule(t *testing.T) {
+	var calls int32
+	router := newFunctionRouter(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	lister := &fakeLister{functions: []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{
+			ScheduleAnnotation:  "@daily",
+			MissedRunAnnotation: string(MissedRunOnce),
+		}),
+	}}
+
+	s := New(Config{}, lister, router)
+	now := time.Now()
+
+	s.refresh(context.Background(), now)
+
+	lister.functions = []types.FunctionStatus{
+		scheduledFunction("report", map[string]string{
+			ScheduleAnnotation:  "@hourly",
+			MissedRunAnnotation: string(MissedRunOnce),
+		}),
+	}
+	edited := now.Add(3 * time.Hour)
+	s.refresh(context.Background(), edited)
+	s.wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("want no missed runs for an edited schedule, got %d", got)
+	}
+	if got := s.state["report"]; !got.Equal(edited) {
+		t.Errorf("want last run reset to %s, got %s", edited, got)
+	}
+	if want := s.jobs["report"].schedule.Next(edited); !s.jobs["report"].next.Equal(want) {
+		t.Errorf("want next run %s, got %s", want, s.jobs["report"].next)
+	}
+}
@@ -5,16 +5,19 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/openfaas/faas-provider/auth"
+	"github.com/openfaas/faas-provider/accesslog"
+	"github.com/openfaas/faas-provider/tracing/exporter"
 	"github.com/openfaas/faas-provider/types"
-
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // NameExpression for a function / service
@@ -33,112 +36,240 @@ func Router() *mux.Router {
 }
 
 // Serve load your handlers into the correct OpenFaaS route spec. This function is blocking.
+//
+// The routes are registered on the package-level router returned by Router, use NewHandler
+// to serve the API from your own server or router. Serve exits the process on errors, use Run
+// to handle them instead.
 func Serve(ctx context.Context, handlers *types.FaaSHandlers, config *types.FaaSConfig) {
+	if err := Run(ctx, handlers, config); err != nil {
+		config.GetLogger().Error("failed to serve the provider API", "error", err.Error())
+		os.Exit(1)
+	}
+}
 
-	if config.EnableBasicAuth {
-		reader := auth.ReadBasicAuthFromDisk{
-			SecretMountPath: config.SecretMountPath,
-		}
+// Run serves your handlers with the OpenFaaS route spec on the package-level router until ctx
+// is done, then shuts down gracefully within the config's ShutdownTimeout. Like Serve, Run can
+// only be called once per process, but errors are returned rather than exiting the process.
+//
+// The API listens on the config's Listener, a systemd socket, UnixSocketPath or TCPPort, and
+// config.OnReady is called once all of the listeners are bound. The "/system/" routes are served on the
+// config's AdminListener and the "/metrics" and "/healthz" routes on its MetricsListener, when set.
+func Run(ctx context.Context, handlers *types.FaaSHandlers, config *types.FaaSConfig) error {
+	shutdownTracing, err := exporter.Setup(ctx, *config)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
 
-		credentials, err := reader.Read()
-		if err != nil {
-			log.Fatalf("failed to read basic auth credentials: %s", err)
+	servers, err := newServers(handlers, config)
+	if err != nil {
+		return errors.Join(err, shutdownTracing(context.Background()))
+	}
+
+	// Bind all listeners before serving, so that none are left open when one fails.
+	for i, s := range servers {
+		if s.listener, err = s.listen(); err != nil {
+			for _, bound := range servers[:i] {
+				bound.listener.Close()
+			}
+			return errors.Join(err, shutdownTracing(context.Background()))
 		}
+	}
 
-		handlers.FunctionLister = auth.DecorateWithBasicAuth(handlers.FunctionLister, credentials)
-		handlers.DeployFunction = auth.DecorateWithBasicAuth(handlers.DeployFunction, credentials)
-		handlers.DeleteFunction = auth.DecorateWithBasicAuth(handlers.DeleteFunction, credentials)
-		handlers.UpdateFunction = auth.DecorateWithBasicAuth(handlers.UpdateFunction, credentials)
-		handlers.FunctionStatus = auth.DecorateWithBasicAuth(handlers.FunctionStatus, credentials)
-		handlers.ScaleFunction = auth.DecorateWithBasicAuth(handlers.ScaleFunction, credentials)
-		handlers.Info = auth.DecorateWithBasicAuth(handlers.Info, credentials)
-		handlers.Secrets = auth.DecorateWithBasicAuth(handlers.Secrets, credentials)
-		handlers.Logs = auth.DecorateWithBasicAuth(handlers.Logs, credentials)
-
-		if handlers.Telemetry != nil {
-			handlers.Telemetry = auth.DecorateWithBasicAuth(handlers.Telemetry, credentials)
+	if config.OnReady != nil {
+		addrs := make(map[string]net.Addr, len(servers))
+		for _, s := range servers {
+			addrs[s.name] = s.listener.Addr()
 		}
+		config.OnReady(addrs)
 	}
 
-	hm := newHttpMetrics()
+	// Start servers in goroutines
+	serveErr := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			if err := s.serve(); !errors.Is(err, http.ErrServerClosed) {
+				// The server only closes the listener once it is serving, so it is closed
+				// here to remove a Unix socket.
+				s.listener.Close()
+				serveErr <- fmt.Errorf("failed to serve the provider API on the %s listener: %w", s.name, err)
+			}
+		}()
+	}
 
-	// System (auth) endpoints
-	r.HandleFunc("/system/functions", hm.InstrumentHandler(handlers.FunctionLister, "")).Methods(http.MethodGet)
-	r.HandleFunc("/system/functions", hm.InstrumentHandler(handlers.DeployFunction, "")).Methods(http.MethodPost)
-	r.HandleFunc("/system/functions", hm.InstrumentHandler(handlers.DeleteFunction, "")).Methods(http.MethodDelete)
-	r.HandleFunc("/system/functions", hm.InstrumentHandler(handlers.UpdateFunction, "")).Methods(http.MethodPut)
+	// Shutdown servers when context is done, or when one of them fails.
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+	}
 
-	r.HandleFunc("/system/function/{name:["+NameExpression+"]+}",
-		hm.InstrumentHandler(handlers.FunctionStatus, "/system/function")).Methods(http.MethodGet)
-	r.HandleFunc("/system/scale-function/{name:["+NameExpression+"]+}",
-		hm.InstrumentHandler(handlers.ScaleFunction, "/system/scale-function")).Methods(http.MethodPost)
+	var wg sync.WaitGroup
+	shutdownErrs := make([]error, len(servers))
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shutdownErrs[i] = shutdown(s.server, config.ShutdownTimeout)
+		}()
+	}
+	wg.Wait()
 
-	r.HandleFunc("/system/info",
-		hm.InstrumentHandler(handlers.Info, "")).Methods(http.MethodGet)
+	err = errors.Join(append([]error{err}, shutdownErrs...)...)
 
-	r.HandleFunc("/system/secrets",
-		hm.InstrumentHandler(handlers.Secrets, "")).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+	if tracingErr := shutdownTracing(context.Background()); tracingErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to flush trace spans: %w", tracingErr))
+	}
 
-	r.HandleFunc("/system/logs",
-		hm.InstrumentHandler(handlers.Logs, "")).Methods(http.MethodGet)
+	return err
+}
 
-	r.HandleFunc("/system/namespaces", hm.InstrumentHandler(handlers.ListNamespaces, "")).Methods(http.MethodGet)
+// server is one of the listeners of the API.
+type server struct {
+	name     string
+	server   *http.Server
+	listen   func() (net.Listener, error)
+	listener net.Listener
+}
 
-	// Only register the mutate namespace handler if it is defined
-	if handlers.MutateNamespace != nil {
-		r.HandleFunc("/system/namespace/{name:["+NameExpression+"]*}",
-			hm.InstrumentHandler(handlers.MutateNamespace, "")).Methods(http.MethodPost, http.MethodDelete, http.MethodPut, http.MethodGet)
-	} else {
-		r.HandleFunc("/system/namespace/{name:["+NameExpression+"]*}",
-			hm.InstrumentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				http.Error(w, "Feature not implemented in this version of OpenFaaS", http.StatusNotImplemented)
-			}), "")).Methods(http.MethodGet)
+// serve accepts connections on the listener, with TLS when a certificate is configured.
+func (s *server) serve() error {
+	if s.server.TLSConfig != nil {
+		return s.server.ServeTLS(s.listener, "", "")
 	}
 
-	proxyHandler := handlers.FunctionProxy
+	return s.server.Serve(s.listener)
+}
 
-	// Open endpoints
-	r.HandleFunc("/function/{name:["+NameExpression+"]+}", proxyHandler)
-	r.HandleFunc("/function/{name:["+NameExpression+"]+}/", proxyHandler)
-	r.HandleFunc("/function/{name:["+NameExpression+"]+}/{params:.*}", proxyHandler)
+// serverTLSConfig returns the TLS config for a listener, with the certificate and key read
+// from disk before the listener is bound. The config is nil when TLS is not enabled.
+func serverTLSConfig(tlsConfig *tls.Config, certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return tlsConfig, nil
+	}
 
-	if handlers.Health != nil {
-		r.HandleFunc("/healthz", handlers.Health).
-			Methods(http.MethodGet, http.MethodHead)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
 	}
 
-	if handlers.Telemetry != nil {
-		r.HandleFunc("/system/telemetry", hm.InstrumentHandler(handlers.Telemetry, "")).Methods(http.MethodGet)
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.Certificates = append([]tls.Certificate{cert}, tlsConfig.Certificates...)
+
+	return tlsConfig, nil
+}
+
+// newServers creates the public server, followed by the admin and metrics servers when their
+// listeners are configured.
+func newServers(handlers *types.FaaSHandlers, config *types.FaaSConfig) ([]*server, error) {
+	if config.AccessLogFormat != "" {
+		// The listeners share one writer, so that their lines do not interleave.
+		shared := *config
+		shared.AccessLogWriter = accesslog.NewSyncWriter(config.AccessLogWriter)
+		config = &shared
 	}
 
-	r.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
+	routes := AllRoutes
+	if config.AdminListener != nil {
+		routes &^= AdminRoutes
+	}
+	if config.MetricsListener != nil {
+		routes &^= MetricsRoutes
+	}
 
-	readTimeout := config.ReadTimeout
-	writeTimeout := config.WriteTimeout
+	handler, err := NewHandler(handlers, config, WithRouter(r), WithRoutes(routes))
+	if err != nil {
+		return nil, err
+	}
 
-	port := 8080
-	if config.TCPPort != nil {
-		port = *config.TCPPort
+	tlsConfig, err := serverTLSConfig(config.TLSConfig, config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
 	}
 
-	s := &http.Server{
-		Addr:           fmt.Sprintf(":%d", port),
-		ReadTimeout:    readTimeout,
-		WriteTimeout:   writeTimeout,
-		MaxHeaderBytes: http.DefaultMaxHeaderBytes, // 1MB - can be overridden by setting Server.MaxHeaderBytes.
-		Handler:        r,
+	servers := []*server{{
+		name: types.ListenerPublic,
+		server: &http.Server{
+			ReadTimeout:    config.ReadTimeout,
+			WriteTimeout:   config.WriteTimeout,
+			MaxHeaderBytes: http.DefaultMaxHeaderBytes, // 1MB - can be overridden by setting Server.MaxHeaderBytes.
+			Handler:        handler,
+			TLSConfig:      tlsConfig,
+		},
+		listen: func() (net.Listener, error) {
+			return listen(config)
+		},
+	}}
+
+	split := []struct {
+		name     string
+		listener *types.ListenerConfig
+		routes   Routes
+	}{
+		{name: types.ListenerAdmin, listener: config.AdminListener, routes: AdminRoutes},
+		{name: types.ListenerMetrics, listener: config.MetricsListener, routes: MetricsRoutes},
 	}
 
-	// Start server in a goroutine
-	go func() {
-		if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			log.Fatal(err)
+	for _, sc := range split {
+		if sc.listener == nil {
+			continue
+		}
+
+		handler, err := NewHandler(handlers, config, WithRoutes(sc.routes))
+		if err != nil {
+			return nil, err
+		}
+
+		readTimeout := sc.listener.ReadTimeout
+		if readTimeout == 0 {
+			readTimeout = config.ReadTimeout
+		}
+
+		writeTimeout := sc.listener.WriteTimeout
+		if writeTimeout == 0 {
+			writeTimeout = config.WriteTimeout
+		}
+
+		lc := sc.listener
+		tlsConfig, err := serverTLSConfig(lc.TLSConfig, lc.TLSCertFile, lc.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s listener: %w", sc.name, err)
 		}
-	}()
 
-	// Shutdown server when context is done.
-	<-ctx.Done()
-	if err := s.Shutdown(context.Background()); err != nil {
-		log.Printf("Failed to shut down provider gracefully: %s", err)
+		servers = append(servers, &server{
+			name: sc.name,
+			server: &http.Server{
+				ReadTimeout:    readTimeout,
+				WriteTimeout:   writeTimeout,
+				MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+				Handler:        handler,
+				TLSConfig:      tlsConfig,
+			},
+			listen: func() (net.Listener, error) {
+				return listenSplit(lc)
+			},
+		})
 	}
+
+	return servers, nil
+}
+
+// shutdown waits for in-flight requests to complete for up to timeout, or without a deadline
+// when timeout is 0, then closes the remaining connections.
+func shutdown(s *http.Server, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := s.Shutdown(ctx); err != nil {
+		s.Close()
+		return fmt.Errorf("failed to shut down provider gracefully: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,238 @@
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_Run_ReadyAndShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	port := 0
+	ready := make(chan net.Addr, 1)
+	config := &types.FaaSConfig{
+		TCPPort:         &port,
+		ShutdownTimeout: time.Second,
+		OnReady: func(addrs map[string]net.Addr) {
+			ready <- addrs[types.ListenerPublic]
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, newTestHandlers("run"), config)
+	}()
+
+	var addr net.Addr
+	select {
+	case addr = <-ready:
+	case err := <-done:
+		t.Fatalf("want OnReady to be called, got error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for OnReady")
+	}
+
+	res, err := http.Get("http://" + addr.String() + "/system/info")
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("want no error after shutdown, got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for Run to return")
+	}
+}
+
+func Test_Run_ListenError(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	config := &types.FaaSConfig{
+		TCPPort: &port,
+		OnReady: func(addrs map[string]net.Addr) {
+			t.Errorf("want OnReady not to be called, got: %v", addrs)
+		},
+	}
+
+	if err := Run(context.Background(), newTestHandlers("run"), config); err == nil {
+		t.Fatalf("want error for port in use, got nil")
+	}
+}
+
+func Test_Run_TLSCertError(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "provider.sock")
+
+	config := &types.FaaSConfig{
+		UnixSocketPath: socket,
+		TLSCertFile:    filepath.Join(dir, "missing.crt"),
+		TLSKeyFile:     filepath.Join(dir, "missing.key"),
+		OnReady: func(addrs map[string]net.Addr) {
+			t.Errorf("want OnReady not to be called, got: %v", addrs)
+		},
+	}
+
+	if err := Run(context.Background(), newTestHandlers("tls"), config); err == nil {
+		t.Fatalf("want error for a missing certificate, got nil")
+	}
+
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("want no socket to be left behind, got: %v", err)
+	}
+}
+
+func Test_shutdown_GracePeriod(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	go s.Serve(l)
+
+	go http.Get("http://" + l.Addr().String())
+	<-started
+
+	if err := shutdown(s, 50*time.Millisecond); err == nil {
+		t.Fatalf("want error when the grace period expires, got nil")
+	}
+}
+
+func Test_Run_SplitListeners(t *testing.T) {
+	// Run registers the public routes on the package-level router, which is shared with
+	// the other tests.
+	defer func(router *mux.Router) { r = router }(r)
+	r = mux.NewRouter()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The admin listener is served with TLS, using the test server's certificate.
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsConfig, client := tlsServer.TLS, tlsServer.Client()
+	tlsServer.Close()
+
+	adminListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := 0
+	ready := make(chan map[string]net.Addr, 1)
+	config := &types.FaaSConfig{
+		TCPPort: &port,
+		OnReady: func(addrs map[string]net.Addr) {
+			ready <- addrs
+		},
+		AdminListener: &types.ListenerConfig{
+			Listener:  adminListener,
+			TLSConfig: tlsConfig,
+		},
+		MetricsListener: &types.ListenerConfig{
+			Listener: metricsListener,
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, newTestHandlers("split"), config)
+	}()
+
+	var addrs map[string]net.Addr
+	select {
+	case addrs = <-ready:
+	case err := <-done:
+		t.Fatalf("want OnReady to be called, got error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for OnReady")
+	}
+
+	if len(addrs) != 3 {
+		t.Fatalf("want the addresses of 3 listeners, got: %v", addrs)
+	}
+	if addrs[types.ListenerAdmin].String() != adminListener.Addr().String() {
+		t.Errorf("want admin address %s, got %s", adminListener.Addr(), addrs[types.ListenerAdmin])
+	}
+	if addrs[types.ListenerMetrics].String() != metricsListener.Addr().String() {
+		t.Errorf("want metrics address %s, got %s", metricsListener.Addr(), addrs[types.ListenerMetrics])
+	}
+
+	public := "http://" + addrs[types.ListenerPublic].String()
+	admin := "https://" + addrs[types.ListenerAdmin].String()
+	metrics := "http://" + addrs[types.ListenerMetrics].String()
+
+	cases := []struct {
+		url    string
+		status int
+	}{
+		{url: public + "/function/env", status: http.StatusOK},
+		{url: public + "/system/info", status: http.StatusNotFound},
+		{url: public + "/healthz", status: http.StatusNotFound},
+		{url: admin + "/system/info", status: http.StatusOK},
+		{url: admin + "/function/env", status: http.StatusNotFound},
+		{url: metrics + "/healthz", status: http.StatusOK},
+		{url: metrics + "/metrics", status: http.StatusOK},
+		{url: metrics + "/system/info", status: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		res, err := client.Get(tc.url)
+		if err != nil {
+			t.Fatalf("want no error for %s, got: %s", tc.url, err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != tc.status {
+			t.Errorf("want status %d for %s, got %d", tc.status, tc.url, res.StatusCode)
+		}
+	}
+
+	// Connections which were dialed but never used would delay the shutdown.
+	client.CloseIdleConnections()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("want no error after shutdown, got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for Run to return")
+	}
+}
@@ -0,0 +1,72 @@
+// Package exporter installs the OpenTelemetry TracerProvider and exporter for the spans of
+// the tracing package.
+//
+// It is kept apart from the tracing package so that the exporters are only linked into
+// programs which set up tracing, such as those using bootstrap.Run.
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openfaas/faas-provider/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup installs the global TracerProvider, with the exporter from the config, and the W3C
+// trace context propagator when tracing is enabled. The returned function flushes and stops
+// the exporter, it does nothing when tracing is disabled.
+func Setup(ctx context.Context, config types.FaaSConfig) (func(context.Context) error, error) {
+	if config.TracingExporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", config.GetTracingServiceName()),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(config.GetTracingSampleRatio()),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, config types.FaaSConfig) (sdktrace.SpanExporter, error) {
+	switch config.TracingExporter {
+	case types.TracingExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.TracingEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.TracingEndpoint))
+		}
+		if config.TracingInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, options...)
+
+	case types.TracingExporterStdout:
+		return stdouttrace.New()
+	}
+
+	return nil, fmt.Errorf("unknown tracing exporter: %q", config.TracingExporter)
+}
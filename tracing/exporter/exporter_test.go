@@ -0,0 +1,39 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+func Test_Setup(t *testing.T) {
+	cases := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{name: "disabled", exporter: ""},
+		{name: "stdout", exporter: types.TracingExporterStdout},
+		{name: "unknown", exporter: "zipkin", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), types.FaaSConfig{TracingExporter: tc.exporter})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got %s", err)
+			}
+
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("want no error on shutdown, got %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// untracedRoutes are called frequently by probes and scrapes, so are not traced.
+var untracedRoutes = map[string]bool{
+	"/healthz": true,
+	"/metrics": true,
+}
+
+// Middleware is a mux.MiddlewareFunc which creates a server span for each request, as a
+// child of the span in the caller's traceparent header. The span is named after the route,
+// such as "GET /system/function/{name}".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(r)
+		if untracedRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			))
+		defer span.End()
+
+		if callID := httputil.CallID(r); callID != "" {
+			span.SetAttributes(attribute.String("faas.call_id", callID))
+		}
+
+		ww := httputil.NewHttpWriteInterceptor(w)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", ww.Status()))
+		if ww.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(ww.Status()))
+		}
+	})
+}
+
+// routeName returns the path template of the matched route without the regular
+// expressions of its variables, or the request path when no route was matched.
+func routeName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return r.URL.Path
+	}
+
+	var name strings.Builder
+	depth := 0
+	skip := false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				skip = false
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skip = false
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+
+		if !skip || depth == 0 {
+			name.WriteRune(c)
+		}
+	}
+
+	return name.String()
+}
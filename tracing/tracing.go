@@ -0,0 +1,45 @@
+// Package tracing creates OpenTelemetry spans for the provider's API and function proxy.
+//
+// Spans are created for each route by Middleware, and by the proxy for resolving and invoking
+// functions, with the traceparent header passed on to the function. They are recorded once
+// exporter.Setup, called by bootstrap.Run, has installed a TracerProvider.
+package tracing
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation scope of the spans created by the provider.
+const TracerName = "github.com/openfaas/faas-provider"
+
+const (
+	// FunctionNameKey is the name of the function for a span.
+	FunctionNameKey = attribute.Key("faas.name")
+
+	// NamespaceKey is the namespace of the function for a span, when it is part of the
+	// function name such as "figlet.openfaas-fn".
+	NamespaceKey = attribute.Key("faas.namespace")
+)
+
+// Tracer returns the provider's tracer from the global TracerProvider, spans are not
+// recorded unless exporter.Setup has enabled tracing.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// FunctionAttributes returns the attributes for a function name, which may include the
+// namespace after the last ".".
+func FunctionAttributes(functionName string) []attribute.KeyValue {
+	if i := strings.LastIndex(functionName, "."); i > 0 {
+		return []attribute.KeyValue{
+			FunctionNameKey.String(functionName[:i]),
+			NamespaceKey.String(functionName[i+1:]),
+		}
+	}
+
+	return []attribute.KeyValue{FunctionNameKey.String(functionName)}
+}
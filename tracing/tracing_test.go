@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTestRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+func Test_FunctionAttributes(t *testing.T) {
+	cases := []struct {
+		functionName string
+		want         []attribute.KeyValue
+	}{
+		{functionName: "figlet", want: []attribute.KeyValue{FunctionNameKey.String("figlet")}},
+		{functionName: "figlet.openfaas-fn", want: []attribute.KeyValue{FunctionNameKey.String("figlet"), NamespaceKey.String("openfaas-fn")}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.functionName, func(t *testing.T) {
+			got := FunctionAttributes(tc.functionName)
+			if len(got) != len(tc.want) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("want %v, got %v", tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_Middleware(t *testing.T) {
+	recorder := newTestRecorder(t)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/system/function/{name:[-a-zA-Z_0-9.]+}", func(w http.ResponseWriter, r *http.Request) {
+		if !trace.SpanContextFromContext(r.Context()).IsValid() {
+			t.Error("want a span in the request context")
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "http://gateway/system/function/figlet", nil)
+	req.Header.Set("traceparent", testTraceParent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://gateway/healthz", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "GET /system/function/{name}" {
+		t.Errorf("want span name GET /system/function/{name}, got %s", span.Name())
+	}
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("want a server span, got %s", span.SpanKind())
+	}
+	if got := span.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want the trace from the traceparent header, got %s", got)
+	}
+
+	found := false
+	for _, attr := range span.Attributes() {
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() == http.StatusNotFound {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want the status code attribute, got %v", span.Attributes())
+	}
+}
@@ -1,15 +1,69 @@
 package types
 
 import (
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"time"
 )
 
 const (
-	defaultReadTimeout  = 10 * time.Second
-	defaultMaxIdleConns = 1024
+	// UpstreamHTTP1 is the default protocol used by the proxy to invoke functions.
+	UpstreamHTTP1 = "http1"
+	// UpstreamH2C uses cleartext HTTP/2 with prior knowledge to invoke functions.
+	UpstreamH2C = "h2c"
+	// UpstreamH2 uses HTTP/2 over TLS to invoke functions.
+	UpstreamH2 = "h2"
 )
 
+const (
+	// TracingExporterOTLP sends trace spans to an OpenTelemetry collector over OTLP/HTTP.
+	TracingExporterOTLP = "otlp"
+	// TracingExporterStdout writes trace spans to stdout, which is useful for debugging.
+	TracingExporterStdout = "stdout"
+)
+
+const (
+	// AccessLogFormatCommon writes the access log in the Common Log Format.
+	AccessLogFormatCommon = "common"
+	// AccessLogFormatCombined writes the access log in the Combined Log Format, which adds the
+	// Referer and User-Agent to the Common Log Format.
+	AccessLogFormatCombined = "combined"
+	// AccessLogFormatJSON writes the access log as JSON lines, including the latency, function
+	// name and call ID.
+	AccessLogFormatJSON = "json"
+)
+
+const (
+	// ListenerPublic names the API's listener in the addresses given to OnReady.
+	ListenerPublic = "public"
+	// ListenerAdmin names the AdminListener in the addresses given to OnReady.
+	ListenerAdmin = "admin"
+	// ListenerMetrics names the MetricsListener in the addresses given to OnReady.
+	ListenerMetrics = "metrics"
+)
+
+const (
+	defaultReadTimeout        = 10 * time.Second
+	defaultMaxIdleConns       = 1024
+	defaultCompressionMinSize = 1024
+	defaultTracingServiceName = "faas-provider"
+	defaultUnixSocketMode     = 0660
+)
+
+// defaultCompressionContentTypes are compressed by the proxy when no
+// CompressionContentTypes are configured.
+var defaultCompressionContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
 // FaaSHandlers provide handlers for OpenFaaS
 type FaaSHandlers struct {
 	// ListNamespace lists namespaces which are annotated for OpenFaaS
@@ -50,6 +104,31 @@ type FaaSHandlers struct {
 	Info http.HandlerFunc
 
 	Telemetry http.HandlerFunc
+
+	// RequestQueuer publishes asynchronous invocations made to "/async-function/".
+	// If the queuer is not set, then the "/async-function/" path will not be configured
+	RequestQueuer RequestQueuer
+
+	// AsyncStatus returns the status of a call made to "/async-function/" at "/system/async/{callId}",
+	// use queue.NewStatusHandlerFunc with the StatusStore of the queue.
+	// If the handler is not set, then the "/system/async/" path will not be configured
+	AsyncStatus http.HandlerFunc
+
+	// Webhook verifies signed webhooks sent to "/webhook/{name}" before they are forwarded to
+	// the function, use webhook.NewHandlerFunc with the FunctionProxy.
+	// If the handler is not set, then the "/webhook/" path will not be configured
+	Webhook http.HandlerFunc
+
+	// RevisionStore keeps the revisions recorded by the DeployFunction and UpdateFunction
+	// handlers, use revisions.NewMemoryStore or a persistent store.
+	// If the store is not set, then the "/system/function/{name}/revisions" and
+	// "/system/function/{name}/rollback" paths will not be configured
+	RevisionStore RevisionStore
+
+	// Traffic manages the traffic splits between versions of functions at "/system/traffic",
+	// use proxy.NewTrafficHandlerFunc with the TrafficSplits given to the FunctionProxy.
+	// If the handler is not set, then the "/system/traffic" path will not be configured
+	Traffic http.HandlerFunc
 }
 
 // FaaSConfig set config for HTTP handlers
@@ -74,6 +153,140 @@ type FaaSConfig struct {
 	MaxIdleConns int
 	// MaxIdleConnsPerHost with a default value of 1024, can be used for tuning HTTP proxy performance.
 	MaxIdleConnsPerHost int
+	// MaxRequestBodySize is the maximum size in bytes of a request body which will be
+	// forwarded to a function by the proxy. The default value of 0 means no limit.
+	MaxRequestBodySize int64
+	// EnableCompression enables gzip, zstd and brotli compression of function responses in
+	// the proxy, when requested by the client through the Accept-Encoding header.
+	EnableCompression bool
+	// CompressionMinSize with a default value of 1024, is the smallest response in bytes which
+	// will be compressed.
+	CompressionMinSize int
+	// CompressionContentTypes lists the response Content-Types which will be compressed,
+	// wildcards such as "text/*" are supported. By default text, JSON, JavaScript and XML
+	// responses are compressed.
+	CompressionContentTypes []string
+	// ResponseCacheSize is the number of entries held in memory by the proxy for GET requests,
+	// when allowed by the function's Cache-Control header. Each cached resource uses one entry
+	// for the index of its Vary headers and one for each variant, so about half as many
+	// responses are held. The default value of 0 disables the cache.
+	ResponseCacheSize int
+	// UpstreamProtocol is the protocol used by the proxy to invoke functions, one of UpstreamHTTP1,
+	// UpstreamH2C or UpstreamH2. The default is UpstreamHTTP1.
+	//
+	// UpstreamH2C uses a dedicated HTTP/2 transport which multiplexes requests over one
+	// connection per replica, so MaxIdleConns and MaxIdleConnsPerHost do not apply to it, and
+	// MaxConnsPerHost can not be combined with it.
+	UpstreamProtocol string
+	// MaxConnsPerHost limits the number of connections the proxy will open to each function
+	// replica. The default value of 0 means no limit. HTTP/2 connections are multiplexed, so
+	// fewer are needed than with HTTP/1.1. It is not supported with UpstreamH2C.
+	MaxConnsPerHost int
+	// EnableGRPC serves gRPC invocations alongside the HTTP routes, this enables cleartext
+	// HTTP/2 (h2c) on the API's port.
+	EnableGRPC bool
+	// TracingExporter enables OpenTelemetry tracing of the API and the proxy with the
+	// TracingExporterOTLP or TracingExporterStdout exporter. The default of "" disables tracing.
+	TracingExporter string
+	// TracingEndpoint is the host:port of the collector for the TracingExporterOTLP exporter,
+	// when empty the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or "localhost:4318" is used.
+	TracingEndpoint string
+	// TracingInsecure disables TLS for the connection to the collector.
+	TracingInsecure bool
+	// TracingSampleRatio is the fraction of new traces which are sampled, the decision of the
+	// caller is followed for requests with a traceparent header. The default of 0 samples all traces.
+	TracingSampleRatio float64
+	// TracingServiceName is the service.name of the trace spans, the default is "faas-provider".
+	TracingServiceName string
+	// Logger is used for the provider's own logs. When nil, a logger which writes to stderr
+	// is created for the LogFormat and LogLevel, or slog.Default() is used when neither is set.
+	Logger *slog.Logger
+	// LogFormat is LogFormatText or LogFormatJSON, the default is LogFormatText.
+	LogFormat string
+	// LogLevel is the minimum level of the logs written, the default is slog.LevelInfo.
+	LogLevel slog.Level
+	// DisableInvocationLogs silences the logs written for each function invocation by the
+	// proxy, such as upstream errors and timings.
+	DisableInvocationLogs bool
+	// AccessLogFormat enables the access log for the API and function routes with the
+	// AccessLogFormatCommon, AccessLogFormatCombined or AccessLogFormatJSON format. The
+	// default of "" disables the access log.
+	AccessLogFormat string
+	// AccessLogWriter receives the access log, the default is os.Stdout. Lines written by
+	// the listeners of bootstrap.Run are serialized.
+	AccessLogWriter io.Writer
+	// AccessLogSampleRatio is the fraction of requests written to the access log, requests
+	// which fail with a 5xx status are always written. The default of 0 writes all requests.
+	AccessLogSampleRatio float64
+	// AccessLogExcludePaths are not written to the access log, a path ending in "/" excludes
+	// all paths below it. The default is "/healthz" and "/metrics".
+	AccessLogExcludePaths []string
+	// ShutdownTimeout is the grace period for in-flight requests to complete when the API is
+	// shut down, before their connections are closed. The default of 0 waits without a deadline.
+	ShutdownTimeout time.Duration
+	// OnReady is called once the API is accepting connections on all of its listeners, with
+	// their addresses by ListenerPublic, ListenerAdmin and ListenerMetrics. It can be used to
+	// signal readiness or to find the ports when TCPPort or a ListenerConfig's Port is 0.
+	OnReady func(addrs map[string]net.Addr)
+	// Listener is used by the API in place of the TCPPort, UnixSocketPath or SocketActivation,
+	// such as a listener created by the caller for tests or a custom transport. The listener is
+	// closed when the API is shut down.
+	Listener net.Listener
+	// UnixSocketPath is the path of a Unix socket for the API to listen on in place of the
+	// TCPPort, so that no TCP port is exposed on single-host deployments.
+	UnixSocketPath string
+	// UnixSocketMode is the file mode of the UnixSocketPath, the default is 0660.
+	UnixSocketMode os.FileMode
+	// SocketActivation uses the first socket passed by systemd through LISTEN_FDS in place of
+	// the TCPPort or UnixSocketPath.
+	SocketActivation bool
+	// TLSCertFile and TLSKeyFile enable TLS on the API's listener with a certificate and key
+	// read from disk.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSConfig enables TLS on the API's listener, with certificates from its Certificates or
+	// GetCertificate when no TLSCertFile is set.
+	TLSConfig *tls.Config
+	// AdminListener serves the "/system/" routes on a separate listener, such as a private
+	// port or Unix socket which can be firewalled from the invocation routes. When it is not
+	// set, the "/system/" routes are served by the API's listener.
+	AdminListener *ListenerConfig
+	// MetricsListener serves the "/metrics" and "/healthz" routes on a separate listener. When
+	// it is not set, they are served by the API's listener.
+	MetricsListener *ListenerConfig
+}
+
+// ListenerConfig configures a listener of the API which is split from the TCPPort, with a
+// default of the FaaSConfig's ReadTimeout and WriteTimeout, and no TLS.
+type ListenerConfig struct {
+	// Port is the TCP port of the listener, 0 picks a free port.
+	Port int
+	// UnixSocketPath is the path of a Unix socket to listen on in place of the Port.
+	UnixSocketPath string
+	// UnixSocketMode is the file mode of the UnixSocketPath, the default is 0660.
+	UnixSocketMode os.FileMode
+	// Listener is used in place of the Port or UnixSocketPath. The listener is closed when the
+	// API is shut down.
+	Listener net.Listener
+	// ReadTimeout is the HTTP timeout for reading a request from clients.
+	ReadTimeout time.Duration
+	// WriteTimeout is the HTTP timeout for writing a response.
+	WriteTimeout time.Duration
+	// TLSCertFile and TLSKeyFile enable TLS with a certificate and key read from disk.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSConfig enables TLS, with certificates from its Certificates or GetCertificate when no
+	// TLSCertFile is set.
+	TLSConfig *tls.Config
+}
+
+// GetUnixSocketMode is a helper to safely return the configured UnixSocketMode or the default of 0660
+func (c *ListenerConfig) GetUnixSocketMode() os.FileMode {
+	if c.UnixSocketMode == 0 {
+		return defaultUnixSocketMode
+	}
+
+	return c.UnixSocketMode.Perm()
 }
 
 // GetReadTimeout is a helper to safely return the configured ReadTimeout or the default value of 10s
@@ -102,3 +315,83 @@ func (c *FaaSConfig) GetMaxIdleConnsPerHost() int {
 
 	return c.MaxIdleConnsPerHost
 }
+
+// GetCompressionMinSize is a helper to safely return the configured CompressionMinSize or the default value of 1024
+func (c *FaaSConfig) GetCompressionMinSize() int {
+	if c.CompressionMinSize < 1 {
+		return defaultCompressionMinSize
+	}
+
+	return c.CompressionMinSize
+}
+
+// GetCompressionContentTypes is a helper to safely return the configured CompressionContentTypes or the
+// default allowlist of text, JSON, JavaScript and XML
+func (c *FaaSConfig) GetCompressionContentTypes() []string {
+	if len(c.CompressionContentTypes) == 0 {
+		return defaultCompressionContentTypes
+	}
+
+	return c.CompressionContentTypes
+}
+
+// GetTracingSampleRatio is a helper to safely return the configured TracingSampleRatio or the default of 1
+func (c *FaaSConfig) GetTracingSampleRatio() float64 {
+	if c.TracingSampleRatio <= 0 || c.TracingSampleRatio > 1 {
+		return 1
+	}
+
+	return c.TracingSampleRatio
+}
+
+// GetTracingServiceName is a helper to safely return the configured TracingServiceName or the default of "faas-provider"
+func (c *FaaSConfig) GetTracingServiceName() string {
+	if c.TracingServiceName == "" {
+		return defaultTracingServiceName
+	}
+
+	return c.TracingServiceName
+}
+
+// GetLogger is a helper to safely return the configured Logger or a new logger for the LogFormat and LogLevel.
+// When neither is set, slog.Default() is returned, which writes through the standard log package
+func (c *FaaSConfig) GetLogger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+
+	if c.LogFormat == "" && c.LogLevel == slog.LevelInfo {
+		return slog.Default()
+	}
+
+	return NewLogger(os.Stderr, c.LogFormat, c.LogLevel)
+}
+
+// GetInvocationLogger is a helper to return the logger for function invocations, which discards
+// logs when DisableInvocationLogs is set
+func (c *FaaSConfig) GetInvocationLogger() *slog.Logger {
+	if c.DisableInvocationLogs {
+		return discardLogger()
+	}
+
+	return c.GetLogger()
+}
+
+// GetUnixSocketMode is a helper to safely return the configured UnixSocketMode or the default of 0660
+func (c *FaaSConfig) GetUnixSocketMode() os.FileMode {
+	if c.UnixSocketMode == 0 {
+		return defaultUnixSocketMode
+	}
+
+	return c.UnixSocketMode.Perm()
+}
+
+// GetUpstreamProtocol is a helper to safely return the configured UpstreamProtocol or the default of UpstreamHTTP1
+func (c *FaaSConfig) GetUpstreamProtocol() string {
+	switch c.UpstreamProtocol {
+	case UpstreamH2C, UpstreamH2:
+		return c.UpstreamProtocol
+	default:
+		return UpstreamHTTP1
+	}
+}
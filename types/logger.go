@@ -0,0 +1,44 @@
+package types
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+const (
+	// LogFormatText writes the provider's logs as logfmt-style key=value lines.
+	LogFormatText = "text"
+	// LogFormatJSON writes the provider's logs as JSON lines.
+	LogFormatJSON = "json"
+)
+
+// discardLevel is above any level used for logs, so nothing is written.
+const discardLevel = slog.Level(math.MaxInt32)
+
+// NewLogger creates a slog.Logger which writes LogFormatText or LogFormatJSON lines to w,
+// for records at level or above.
+func NewLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+
+	if strings.EqualFold(format, LogFormatJSON) {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// FunctionLogAttrs returns the "function" and "namespace" fields for a function name, which
+// may include the namespace after the last ".".
+func FunctionLogAttrs(functionName string) []any {
+	if i := strings.LastIndex(functionName, "."); i > 0 {
+		return []any{"function", functionName[:i], "namespace", functionName[i+1:]}
+	}
+
+	return []any{"function", functionName}
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: discardLevel}))
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func Test_NewLogger_JSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := NewLogger(out, LogFormatJSON, slog.LevelInfo)
+
+	logger.Debug("hidden")
+	logger.Error("error with proxy request", FunctionLogAttrs("figlet.openfaas-fn")...)
+
+	var line map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("want a single JSON line, got %q: %s", out.String(), err)
+	}
+
+	if line["msg"] != "error with proxy request" || line["function"] != "figlet" || line["namespace"] != "openfaas-fn" {
+		t.Errorf("want function and namespace fields, got %v", line)
+	}
+}
+
+func Test_NewLogger_Text(t *testing.T) {
+	out := &bytes.Buffer{}
+	NewLogger(out, "", slog.LevelInfo).Info("invoked function", FunctionLogAttrs("figlet")...)
+
+	if got := out.String(); !strings.Contains(got, `msg="invoked function" function=figlet`) {
+		t.Errorf("want a text line, got %q", got)
+	}
+}
+
+func Test_GetInvocationLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := NewLogger(out, LogFormatText, slog.LevelInfo)
+
+	config := FaaSConfig{Logger: logger}
+	if config.GetInvocationLogger() != logger {
+		t.Errorf("want the configured logger")
+	}
+
+	config.DisableInvocationLogs = true
+	config.GetInvocationLogger().Error("error with proxy request")
+	if out.Len() != 0 {
+		t.Errorf("want invocation logs to be discarded, got %q", out.String())
+	}
+}
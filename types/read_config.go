@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -129,5 +130,147 @@ func (ReadConfig) Read(hasEnv HasEnv) (*FaaSConfig, error) {
 
 	}
 
+	maxRequestBodySize := hasEnv.Getenv("max_request_body_size")
+	if len(maxRequestBodySize) > 0 {
+		val, err := strconv.ParseInt(maxRequestBodySize, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_request_body_size: %s", maxRequestBodySize)
+		}
+		cfg.MaxRequestBodySize = val
+	}
+
+	cfg.EnableCompression = ParseBoolValue(hasEnv.Getenv("compression"), false)
+	cfg.CompressionMinSize = ParseIntValue(hasEnv.Getenv("compression_min_size"), defaultCompressionMinSize)
+
+	compressionContentTypes := hasEnv.Getenv("compression_content_types")
+	if len(compressionContentTypes) > 0 {
+		for _, contentType := range strings.Split(compressionContentTypes, ",") {
+			if contentType = strings.TrimSpace(contentType); len(contentType) > 0 {
+				cfg.CompressionContentTypes = append(cfg.CompressionContentTypes, contentType)
+			}
+		}
+	}
+
+	cfg.ResponseCacheSize = ParseIntValue(hasEnv.Getenv("response_cache_size"), 0)
+
+	cfg.UpstreamProtocol = ParseString(hasEnv.Getenv("upstream_protocol"), UpstreamHTTP1)
+	switch cfg.UpstreamProtocol {
+	case UpstreamHTTP1, UpstreamH2C, UpstreamH2:
+	default:
+		return nil, fmt.Errorf("invalid value for upstream_protocol: %s", cfg.UpstreamProtocol)
+	}
+
+	cfg.MaxConnsPerHost = ParseIntValue(hasEnv.Getenv("max_conns_per_host"), 0)
+	if cfg.MaxConnsPerHost > 0 && cfg.UpstreamProtocol == UpstreamH2C {
+		return nil, fmt.Errorf("max_conns_per_host is not supported with upstream_protocol: %s", UpstreamH2C)
+	}
+
+	cfg.EnableGRPC = ParseBoolValue(hasEnv.Getenv("grpc"), false)
+
+	cfg.TracingExporter = hasEnv.Getenv("tracing_exporter")
+	switch cfg.TracingExporter {
+	case "", TracingExporterOTLP, TracingExporterStdout:
+	default:
+		return nil, fmt.Errorf("invalid value for tracing_exporter: %s", cfg.TracingExporter)
+	}
+
+	cfg.TracingEndpoint = hasEnv.Getenv("tracing_endpoint")
+	cfg.TracingInsecure = ParseBoolValue(hasEnv.Getenv("tracing_insecure"), false)
+	cfg.TracingServiceName = hasEnv.Getenv("tracing_service_name")
+
+	tracingSampleRatio := hasEnv.Getenv("tracing_sample_ratio")
+	if len(tracingSampleRatio) > 0 {
+		val, err := strconv.ParseFloat(tracingSampleRatio, 64)
+		if err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for tracing_sample_ratio: %s", tracingSampleRatio)
+		}
+		cfg.TracingSampleRatio = val
+	}
+
+	cfg.LogFormat = strings.ToLower(hasEnv.Getenv("log_format"))
+	switch cfg.LogFormat {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid value for log_format: %s", cfg.LogFormat)
+	}
+
+	logLevel := hasEnv.Getenv("log_level")
+	if len(logLevel) > 0 {
+		if err := cfg.LogLevel.UnmarshalText([]byte(logLevel)); err != nil {
+			return nil, fmt.Errorf("invalid value for log_level: %s", logLevel)
+		}
+	}
+
+	cfg.DisableInvocationLogs = ParseBoolValue(hasEnv.Getenv("disable_invocation_logs"), false)
+
+	cfg.AccessLogFormat = strings.ToLower(hasEnv.Getenv("access_log_format"))
+	switch cfg.AccessLogFormat {
+	case "", AccessLogFormatCommon, AccessLogFormatCombined, AccessLogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid value for access_log_format: %s", cfg.AccessLogFormat)
+	}
+
+	accessLogSampleRatio := hasEnv.Getenv("access_log_sample_ratio")
+	if len(accessLogSampleRatio) > 0 {
+		val, err := strconv.ParseFloat(accessLogSampleRatio, 64)
+		if err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for access_log_sample_ratio: %s", accessLogSampleRatio)
+		}
+		cfg.AccessLogSampleRatio = val
+	}
+
+	accessLogExcludePaths := hasEnv.Getenv("access_log_exclude_paths")
+	if len(accessLogExcludePaths) > 0 {
+		for _, path := range strings.Split(accessLogExcludePaths, ",") {
+			if path = strings.TrimSpace(path); len(path) > 0 {
+				cfg.AccessLogExcludePaths = append(cfg.AccessLogExcludePaths, path)
+			}
+		}
+	}
+
+	cfg.ShutdownTimeout = ParseIntOrDurationValue(hasEnv.Getenv("shutdown_timeout"), 0)
+
+	cfg.UnixSocketPath = hasEnv.Getenv("unix_socket")
+	unixSocketMode := hasEnv.Getenv("unix_socket_mode")
+	if len(unixSocketMode) > 0 {
+		val, err := strconv.ParseUint(unixSocketMode, 8, 32)
+		if err != nil || val > 0777 {
+			return nil, fmt.Errorf("invalid value for unix_socket_mode: %s", unixSocketMode)
+		}
+		cfg.UnixSocketMode = os.FileMode(val)
+	}
+
+	cfg.SocketActivation = ParseBoolValue(hasEnv.Getenv("socket_activation"), false)
+
+	cfg.TLSCertFile = hasEnv.Getenv("tls_cert_file")
+	cfg.TLSKeyFile = hasEnv.Getenv("tls_key_file")
+	if (len(cfg.TLSCertFile) > 0) != (len(cfg.TLSKeyFile) > 0) {
+		return nil, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+
+	if adminPort := hasEnv.Getenv("admin_port"); len(adminPort) > 0 {
+		val, err := strconv.Atoi(adminPort)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for admin_port: %s", adminPort)
+		}
+		cfg.AdminListener = &ListenerConfig{
+			Port:         val,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}
+	}
+
+	if metricsPort := hasEnv.Getenv("metrics_port"); len(metricsPort) > 0 {
+		val, err := strconv.Atoi(metricsPort)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for metrics_port: %s", metricsPort)
+		}
+		cfg.MetricsListener = &ListenerConfig{
+			Port:         val,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}
+	}
+
 	return cfg, nil
 }
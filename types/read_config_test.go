@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"log/slog"
 	"testing"
 	"time"
 )
@@ -236,3 +237,345 @@ func Test_ParseIntOrDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestRead_MaxRequestBodySize(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	defaults.Setenv("max_request_body_size", "1048576")
+
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config")
+	}
+
+	if config.MaxRequestBodySize != 1048576 {
+		t.Fatalf("config.MaxRequestBodySize, want: %d, got: %d\n", 1048576, config.MaxRequestBodySize)
+	}
+}
+
+func TestRead_MaxRequestBodySize_Invalid(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	defaults.Setenv("max_request_body_size", "1MB")
+
+	_, err := readConfig.Read(defaults)
+	if err == nil {
+		t.Fatalf("want error for invalid max_request_body_size")
+	}
+}
+
+func TestRead_UpstreamProtocol(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: UpstreamHTTP1},
+		{value: "h2c", want: UpstreamH2C},
+		{value: "h2", want: UpstreamH2},
+		{value: "http3", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			defaults := NewEnvBucket()
+			defaults.Setenv("upstream_protocol", tc.value)
+
+			readConfig := ReadConfig{}
+			config, err := readConfig.Read(defaults)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error for upstream_protocol %q", tc.value)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error while reading config: %s", err)
+			}
+
+			if config.UpstreamProtocol != tc.want {
+				t.Fatalf("config.UpstreamProtocol, want: %s, got: %s", tc.want, config.UpstreamProtocol)
+			}
+		})
+	}
+}
+
+func TestRead_ShutdownTimeout(t *testing.T) {
+	cases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "30", want: 30 * time.Second},
+		{value: "1m", want: time.Minute},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			defaults := NewEnvBucket()
+			defaults.Setenv("shutdown_timeout", tc.value)
+
+			readConfig := ReadConfig{}
+			config, err := readConfig.Read(defaults)
+			if err != nil {
+				t.Fatalf("unexpected error while reading config: %s", err)
+			}
+
+			if config.ShutdownTimeout != tc.want {
+				t.Fatalf("config.ShutdownTimeout, want: %s, got: %s", tc.want, config.ShutdownTimeout)
+			}
+		})
+	}
+}
+
+func TestRead_UnixSocket(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("unix_socket", "/run/faasd/provider.sock")
+	defaults.Setenv("unix_socket_mode", "0600")
+	defaults.Setenv("socket_activation", "true")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.UnixSocketPath != "/run/faasd/provider.sock" {
+		t.Fatalf("config.UnixSocketPath, want: %s, got: %s", "/run/faasd/provider.sock", config.UnixSocketPath)
+	}
+	if config.GetUnixSocketMode() != 0600 {
+		t.Fatalf("config.UnixSocketMode, want: %o, got: %o", 0600, config.GetUnixSocketMode())
+	}
+	if !config.SocketActivation {
+		t.Fatalf("config.SocketActivation, want: true, got: false")
+	}
+}
+
+func TestRead_UnixSocketMode_Invalid(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("unix_socket_mode", "rw-rw----")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want error for invalid unix_socket_mode")
+	}
+}
+
+func TestRead_SplitListeners(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("admin_port", "8081")
+	defaults.Setenv("metrics_port", "8082")
+	defaults.Setenv("write_timeout", "60s")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.AdminListener == nil || config.AdminListener.Port != 8081 {
+		t.Fatalf("config.AdminListener.Port, want: %d, got: %v", 8081, config.AdminListener)
+	}
+	if config.AdminListener.WriteTimeout != time.Minute {
+		t.Fatalf("config.AdminListener.WriteTimeout, want: %s, got: %s", time.Minute, config.AdminListener.WriteTimeout)
+	}
+	if config.MetricsListener == nil || config.MetricsListener.Port != 8082 {
+		t.Fatalf("config.MetricsListener.Port, want: %d, got: %v", 8082, config.MetricsListener)
+	}
+}
+
+func TestRead_SplitListeners_Defaults(t *testing.T) {
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(NewEnvBucket())
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.AdminListener != nil || config.MetricsListener != nil {
+		t.Fatalf("want no split listeners by default, got admin: %v, metrics: %v", config.AdminListener, config.MetricsListener)
+	}
+}
+
+func TestRead_TLSKeyWithoutCert(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("tls_key_file", "/run/secrets/tls.key")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want error for tls_key_file without tls_cert_file")
+	}
+}
+
+func TestRead_MaxConnsPerHost_H2C(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("upstream_protocol", "h2c")
+	defaults.Setenv("max_conns_per_host", "4")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want error for max_conns_per_host with h2c")
+	}
+}
+
+func TestRead_Tracing(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("tracing_exporter", "otlp")
+	defaults.Setenv("tracing_endpoint", "collector:4318")
+	defaults.Setenv("tracing_insecure", "true")
+	defaults.Setenv("tracing_sample_ratio", "0.25")
+	defaults.Setenv("tracing_service_name", "faas-netes")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.TracingExporter != TracingExporterOTLP {
+		t.Errorf("config.TracingExporter, want: %s, got: %s", TracingExporterOTLP, config.TracingExporter)
+	}
+	if config.TracingEndpoint != "collector:4318" {
+		t.Errorf("config.TracingEndpoint, want: %s, got: %s", "collector:4318", config.TracingEndpoint)
+	}
+	if !config.TracingInsecure {
+		t.Errorf("config.TracingInsecure, want: %t, got: %t", true, config.TracingInsecure)
+	}
+	if config.TracingSampleRatio != 0.25 {
+		t.Errorf("config.TracingSampleRatio, want: %v, got: %v", 0.25, config.TracingSampleRatio)
+	}
+	if config.TracingServiceName != "faas-netes" {
+		t.Errorf("config.TracingServiceName, want: %s, got: %s", "faas-netes", config.TracingServiceName)
+	}
+}
+
+func TestRead_Tracing_Invalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "exporter", key: "tracing_exporter", value: "zipkin"},
+		{name: "sample ratio over 1", key: "tracing_sample_ratio", value: "1.5"},
+		{name: "sample ratio not a number", key: "tracing_sample_ratio", value: "half"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaults := NewEnvBucket()
+			defaults.Setenv(tc.key, tc.value)
+
+			readConfig := ReadConfig{}
+			if _, err := readConfig.Read(defaults); err == nil {
+				t.Fatalf("want error for %s %q", tc.key, tc.value)
+			}
+		})
+	}
+}
+
+func TestRead_Logging(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_format", "json")
+	defaults.Setenv("log_level", "debug")
+	defaults.Setenv("disable_invocation_logs", "true")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.LogFormat != LogFormatJSON {
+		t.Errorf("config.LogFormat, want: %s, got: %s", LogFormatJSON, config.LogFormat)
+	}
+	if config.LogLevel != slog.LevelDebug {
+		t.Errorf("config.LogLevel, want: %s, got: %s", slog.LevelDebug, config.LogLevel)
+	}
+	if !config.DisableInvocationLogs {
+		t.Errorf("config.DisableInvocationLogs, want: %t, got: %t", true, config.DisableInvocationLogs)
+	}
+}
+
+func TestRead_Logging_Defaults(t *testing.T) {
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(NewEnvBucket())
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.LogFormat != "" || config.LogLevel != slog.LevelInfo || config.DisableInvocationLogs {
+		t.Errorf("want default logging config, got format: %q, level: %s, disable invocation logs: %t",
+			config.LogFormat, config.LogLevel, config.DisableInvocationLogs)
+	}
+}
+
+func TestRead_Logging_Invalid(t *testing.T) {
+	cases := []struct {
+		key   string
+		value string
+	}{
+		{key: "log_format", value: "xml"},
+		{key: "log_level", value: "verbose"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			defaults := NewEnvBucket()
+			defaults.Setenv(tc.key, tc.value)
+
+			readConfig := ReadConfig{}
+			if _, err := readConfig.Read(defaults); err == nil {
+				t.Fatalf("want error for %s %q", tc.key, tc.value)
+			}
+		})
+	}
+}
+
+func TestRead_AccessLog(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("access_log_format", "combined")
+	defaults.Setenv("access_log_sample_ratio", "0.1")
+	defaults.Setenv("access_log_exclude_paths", "/healthz, /system/info/")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("unexpected error while reading config: %s", err)
+	}
+
+	if config.AccessLogFormat != AccessLogFormatCombined {
+		t.Errorf("config.AccessLogFormat, want: %s, got: %s", AccessLogFormatCombined, config.AccessLogFormat)
+	}
+	if config.AccessLogSampleRatio != 0.1 {
+		t.Errorf("config.AccessLogSampleRatio, want: %v, got: %v", 0.1, config.AccessLogSampleRatio)
+	}
+
+	want := []string{"/healthz", "/system/info/"}
+	if fmt.Sprint(config.AccessLogExcludePaths) != fmt.Sprint(want) {
+		t.Errorf("config.AccessLogExcludePaths, want: %v, got: %v", want, config.AccessLogExcludePaths)
+	}
+}
+
+func TestRead_AccessLog_Invalid(t *testing.T) {
+	cases := []struct {
+		key   string
+		value string
+	}{
+		{key: "access_log_format", value: "apache"},
+		{key: "access_log_sample_ratio", value: "2"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			defaults := NewEnvBucket()
+			defaults.Setenv(tc.key, tc.value)
+
+			readConfig := ReadConfig{}
+			if _, err := readConfig.Read(defaults); err == nil {
+				t.Fatalf("want error for %s %q", tc.key, tc.value)
+			}
+		})
+	}
+}
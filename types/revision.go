@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+// FunctionRevision is a FunctionDeployment which was applied to the provider.
+type FunctionRevision struct {
+	// Revision increases with each deployment of the function
+	Revision int `json:"revision"`
+
+	// Operation is "deploy", "update" or "rollback"
+	Operation string `json:"operation"`
+
+	// RollbackOf is the revision which was restored by a rollback
+	RollbackOf int `json:"rollbackOf,omitempty"`
+
+	// Created is when the deployment was applied
+	Created time.Time `json:"created"`
+
+	// Deployment as it was applied, the Service and Namespace identify the function
+	Deployment FunctionDeployment `json:"deployment"`
+}
+
+// RevisionStore keeps the recent revisions of each function, so that a bad deployment
+// can be rolled back.
+type RevisionStore interface {
+	// Add assigns the next revision number for the function and stores the revision,
+	// older revisions may be removed beyond the store's limit.
+	Add(revision FunctionRevision) (FunctionRevision, error)
+
+	// List returns the revisions of the function, newest first. An empty namespace is
+	// the provider's default.
+	List(namespace, functionName string) ([]FunctionRevision, error)
+}
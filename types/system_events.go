@@ -17,6 +17,8 @@ type FunctionUsageEvent struct {
 	Started      time.Time     `json:"started"`
 	Duration     time.Duration `json:"duration"`
 	MemoryBytes  int64         `json:"memory_bytes"`
+	// CallID of the invocation, see the X-Call-Id header
+	CallID string `json:"call_id,omitempty"`
 }
 
 func (e FunctionUsageEvent) EventType() string {
@@ -32,6 +34,8 @@ type APIAccessEvent struct {
 	CustomMessage string    `json:"custom_message,omitempty"`
 	Namespace     string    `json:"namespace,omitempty"`
 	Time          time.Time `json:"time"`
+	// CallID of the system call, see the X-Call-Id header
+	CallID string `json:"call_id,omitempty"`
 }
 
 func (e APIAccessEvent) EventType() string {
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	dedupeTTL  = 24 * time.Hour
+	dedupeSize = 10000
+)
+
+// deliveries remembers recent delivery IDs, evicting the oldest when it is full. Deliveries
+// which are being forwarded are tracked separately, and are only remembered once they have
+// been processed.
+type deliveries struct {
+	ttl  time.Duration
+	size int
+
+	lock     sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	inFlight map[string]struct{}
+}
+
+type delivery struct {
+	key  string
+	seen time.Time
+}
+
+// deliveryState is the result of starting a delivery.
+type deliveryState int
+
+const (
+	deliveryNew deliveryState = iota
+	deliverySeen
+	deliveryInFlight
+)
+
+func newDeliveries(ttl time.Duration, size int) *deliveries {
+	return &deliveries{
+		ttl:      ttl,
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+// start marks the delivery as in flight and returns deliveryNew, unless it was already
+// seen within the TTL or is in flight. Each delivery which is started must be finished.
+func (d *deliveries) start(key string, now time.Time) deliveryState {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if element, ok := d.entries[key]; ok {
+		if now.Sub(element.Value.(*delivery).seen) < d.ttl {
+			return deliverySeen
+		}
+		d.order.Remove(element)
+		delete(d.entries, key)
+	}
+
+	if _, ok := d.inFlight[key]; ok {
+		return deliveryInFlight
+	}
+
+	d.inFlight[key] = struct{}{}
+	return deliveryNew
+}
+
+// finish ends a delivery which was started, it is remembered as seen when processed is
+// true, otherwise it can be retried.
+func (d *deliveries) finish(key string, now time.Time, processed bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.inFlight, key)
+	if !processed {
+		return
+	}
+
+	d.entries[key] = d.order.PushFront(&delivery{key: key, seen: now})
+
+	for d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*delivery).key)
+	}
+}
@@ -0,0 +1,202 @@
+// Package webhook verifies signed webhooks before they are forwarded to a function.
+//
+// Requests to /webhook/{name} are checked against a secret named by the function's
+// SecretAnnotation, using the scheme of the provider in its ProviderAnnotation. Invalid
+// signatures are rejected with 401, and deliveries which have already been processed are
+// acknowledged without invoking the function again. A delivery which is still being
+// forwarded is rejected with 409, and one which fails with a 5xx status can be retried.
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	// ProviderAnnotation is the Provider which sends webhooks to the function, one of
+	// "github", "stripe" or "generic".
+	ProviderAnnotation = "com.openfaas.webhook.provider"
+
+	// SecretAnnotation is the name of the secret, in the SecretMountPath, used to verify
+	// webhooks sent to the function.
+	SecretAnnotation = "com.openfaas.webhook.secret"
+
+	// defaultMaxBodySize matches the largest payload sent by GitHub.
+	defaultMaxBodySize = 25 * 1024 * 1024
+)
+
+// Config is the webhook configuration of a function.
+type Config struct {
+	Provider Provider
+
+	// Secret is the name of the secret used to verify signatures.
+	Secret string
+}
+
+// Resolver returns the webhook configuration of a function, nil is returned for functions
+// which do not accept webhooks.
+type Resolver interface {
+	ResolveWebhook(functionName string) (*Config, error)
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(functionName string) (*Config, error)
+
+func (f ResolverFunc) ResolveWebhook(functionName string) (*Config, error) {
+	return f(functionName)
+}
+
+// ConfigFromAnnotations reads the webhook configuration from the annotations of a function,
+// nil is returned when the SecretAnnotation is not set. The provider defaults to "generic".
+func ConfigFromAnnotations(annotations map[string]string) (*Config, error) {
+	secret := annotations[SecretAnnotation]
+	if secret == "" {
+		return nil, nil
+	}
+
+	provider := Provider(annotations[ProviderAnnotation])
+	switch provider {
+	case "":
+		provider = ProviderGeneric
+	case ProviderGitHub, ProviderStripe, ProviderGeneric:
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", ProviderAnnotation, provider)
+	}
+
+	return &Config{Provider: provider, Secret: secret}, nil
+}
+
+// NewHandlerFunc creates a http.HandlerFunc for the /webhook/{name} routes which verifies
+// webhooks and then forwards them to next, usually the FunctionProxy handler. The {name}
+// and {params} path variables are the same as for the /function/ routes.
+//
+// Note that this will panic if `resolver` or `next` is nil.
+func NewHandlerFunc(config types.FaaSConfig, resolver Resolver, next http.HandlerFunc) http.HandlerFunc {
+	if resolver == nil {
+		panic("NewHandlerFunc: empty webhook resolver, cannot be nil")
+	}
+	if next == nil {
+		panic("NewHandlerFunc: empty next handler, cannot be nil")
+	}
+
+	maxBodySize := config.MaxRequestBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	logger := config.GetLogger()
+
+	seen := newDeliveries(dedupeTTL, dedupeSize)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		functionName := mux.Vars(r)["name"]
+		if functionName == "" {
+			httputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
+			return
+		}
+
+		webhookConfig, err := resolver.ResolveWebhook(functionName)
+		if err != nil {
+			logger.Error("error resolving webhook", append(types.FunctionLogAttrs(functionName), "error", err.Error())...)
+			httputil.Errorf(w, http.StatusServiceUnavailable, "Unable to resolve webhook for: %s.", functionName)
+			return
+		}
+		if webhookConfig == nil {
+			httputil.Errorf(w, http.StatusNotFound, "No webhook for: %s.", functionName)
+			return
+		}
+
+		secret, err := readSecret(config.SecretMountPath, webhookConfig.Secret)
+		if err != nil {
+			logger.Error("error reading webhook secret", append(types.FunctionLogAttrs(functionName), "error", err.Error())...)
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to verify webhook for: %s.", functionName)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			if err != nil {
+				httputil.Errorf(w, http.StatusRequestEntityTooLarge, "Unable to read request body: %s", err)
+				return
+			}
+		}
+
+		if err := verify(webhookConfig.Provider, r.Header, body, secret, time.Now()); err != nil {
+			recordRequest(functionName, resultRejected)
+			httputil.Errorf(w, http.StatusUnauthorized, "Invalid webhook signature: %s", err)
+			return
+		}
+
+		key := ""
+		if id := deliveryID(webhookConfig.Provider, r.Header, body); id != "" {
+			key = functionName + "\x00" + id
+			switch seen.start(key, time.Now()) {
+			case deliverySeen:
+				recordRequest(functionName, resultDuplicate)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("Duplicate delivery: " + id))
+				return
+			case deliveryInFlight:
+				recordRequest(functionName, resultDuplicate)
+				httputil.Errorf(w, http.StatusConflict, "Delivery in progress: %s", id)
+				return
+			}
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+
+		ww := httputil.NewHttpWriteInterceptor(w)
+		processed := false
+		if key != "" {
+			// Allow the sender to retry deliveries which the function failed to process.
+			defer func() {
+				seen.finish(key, time.Now(), processed)
+			}()
+		}
+
+		next(ww, r)
+
+		if ww.Status() >= http.StatusInternalServerError {
+			recordRequest(functionName, resultFailed)
+			return
+		}
+
+		processed = true
+		recordRequest(functionName, resultAccepted)
+	}
+}
+
+// readSecret reads the named secret, which must be a file directly within the mount path.
+func readSecret(secretMountPath, name string) ([]byte, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid secret name: %q", name)
+	}
+
+	secret, err := os.ReadFile(path.Join(secretMountPath, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSpace(secret), nil
+}
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+func newTestRouter(t *testing.T, next http.HandlerFunc) *mux.Router {
+	secrets := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secrets, "github-secret"), []byte("webhook-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := ResolverFunc(func(functionName string) (*Config, error) {
+		switch functionName {
+		case "deploy":
+			return ConfigFromAnnotations(map[string]string{
+				ProviderAnnotation: "github",
+				SecretAnnotation:   "github-secret",
+			})
+		case "missing-secret":
+			return &Config{Provider: ProviderGitHub, Secret: "not-found"}, nil
+		}
+		return nil, nil
+	})
+
+	handler := NewHandlerFunc(types.FaaSConfig{SecretMountPath: secrets}, resolver, next)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/webhook/{name}", handler)
+	router.HandleFunc("/webhook/{name}/", handler)
+	router.HandleFunc("/webhook/{name}/{params:.*}", handler)
+	return router
+}
+
+func githubRequest(body, delivery, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/webhook/deploy/push", strings.NewReader(body))
+	req.Header.Set(githubSignatureHeader, "sha256="+hexMAC(secret, body))
+	req.Header.Set(githubDeliveryHeader, delivery)
+	return req
+}
+
+func Test_NewHandlerFunc_ForwardsVerifiedWebhook(t *testing.T) {
+	var gotBody, gotParams string
+	router := newTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotParams = mux.Vars(r)["params"]
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, githubRequest(`{"ref":"main"}`, "delivery-1", "webhook-secret"))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if gotBody != `{"ref":"main"}` {
+		t.Errorf("want body to be forwarded, got %q", gotBody)
+	}
+	if gotParams != "push" {
+		t.Errorf("want params push, got %q", gotParams)
+	}
+}
+
+func Test_NewHandlerFunc_Rejects(t *testing.T) {
+	cases := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "invalid signature",
+			req:        githubRequest(`{"ref":"main"}`, "delivery-1", "wrong-secret"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no webhook",
+			req:        httptest.NewRequest(http.MethodPost, "http://gateway/webhook/other", nil),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "missing secret",
+			req:        httptest.NewRequest(http.MethodPost, "http://gateway/webhook/missing-secret", nil),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "method not allowed",
+			req:        httptest.NewRequest(http.MethodGet, "http://gateway/webhook/deploy", nil),
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("want request not to be forwarded")
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tc.req)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status code %d, got %d", tc.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func Test_NewHandlerFunc_DedupesDeliveries(t *testing.T) {
+	calls := 0
+	status := http.StatusInternalServerError
+	router := newTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	})
+
+	// A failed delivery can be retried.
+	router.ServeHTTP(httptest.NewRecorder(), githubRequest(`{}`, "delivery-1", "webhook-secret"))
+
+	status = http.StatusOK
+	router.ServeHTTP(httptest.NewRecorder(), githubRequest(`{}`, "delivery-1", "webhook-secret"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, githubRequest(`{}`, "delivery-1", "webhook-secret"))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("want status code %d for a duplicate, got %d", http.StatusOK, w.Code)
+	}
+
+	if calls != 2 {
+		t.Errorf("want 2 calls to the function, got %d", calls)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), githubRequest(`{}`, "delivery-2", "webhook-secret"))
+	if calls != 3 {
+		t.Errorf("want a new delivery to be forwarded, got %d calls", calls)
+	}
+}
+
+func Test_NewHandlerFunc_InFlightDelivery(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := newTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, githubRequest(`{}`, "delivery-1", "webhook-secret"))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, githubRequest(`{}`, "delivery-1", "webhook-secret"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("want status code %d for a delivery in flight, got %d", http.StatusConflict, w.Code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("want status code %d, got %d", http.StatusOK, code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, githubRequest(`{}`, "delivery-1", "webhook-secret"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Duplicate delivery") {
+		t.Errorf("want duplicate delivery once processed, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func Test_ConfigFromAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        *Config
+		wantErr     bool
+	}{
+		{name: "no secret", annotations: map[string]string{ProviderAnnotation: "github"}, want: nil},
+		{name: "default provider", annotations: map[string]string{SecretAnnotation: "s"}, want: &Config{Provider: ProviderGeneric, Secret: "s"}},
+		{name: "stripe", annotations: map[string]string{SecretAnnotation: "s", ProviderAnnotation: "stripe"}, want: &Config{Provider: ProviderStripe, Secret: "s"}},
+		{name: "invalid provider", annotations: map[string]string{SecretAnnotation: "s", ProviderAnnotation: "gitlab"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ConfigFromAnnotations(tc.annotations)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	resultAccepted  = "accepted"
+	resultRejected  = "rejected"
+	resultDuplicate = "duplicate"
+	resultFailed    = "failed"
+)
+
+// requestTotal counts webhooks partitioned by function name and whether they were accepted,
+// rejected for an invalid signature, acknowledged as a duplicate delivery or failed with a
+// 5xx status from the function.
+var requestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "provider",
+	Name:      "webhook_request_total",
+	Help:      "Total number of webhook requests.",
+}, []string{"function_name", "result"})
+
+func recordRequest(functionName string, result string) {
+	requestTotal.WithLabelValues(functionName, result).Inc()
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+// Provider is the sender of a webhook, which decides how its signature is verified
+// and how deliveries are identified.
+type Provider string
+
+const (
+	// ProviderGitHub verifies the X-Hub-Signature-256 header, deliveries are
+	// identified by the X-GitHub-Delivery header.
+	ProviderGitHub Provider = "github"
+
+	// ProviderStripe verifies the Stripe-Signature header, deliveries are
+	// identified by the id of the event in the body.
+	ProviderStripe Provider = "stripe"
+
+	// ProviderGeneric verifies the signature headers of SetGenericSignature, deliveries
+	// are identified by the DeliveryIDHeader.
+	ProviderGeneric Provider = "generic"
+)
+
+const (
+	githubSignatureHeader = "X-Hub-Signature-256"
+	githubDeliveryHeader  = "X-GitHub-Delivery"
+	stripeSignatureHeader = "Stripe-Signature"
+
+	// DeliveryIDHeader identifies deliveries for the generic provider.
+	DeliveryIDHeader = "X-Delivery-Id"
+
+	// signatureTolerance is the maximum age of a timestamped signature.
+	signatureTolerance = 5 * time.Minute
+)
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// verify checks the signature of the body with the secret.
+func verify(provider Provider, header http.Header, body, secret []byte, now time.Time) error {
+	switch provider {
+	case ProviderGitHub:
+		return verifyGitHub(header, body, secret)
+	case ProviderStripe:
+		return verifyStripe(header, body, secret, now)
+	default:
+		return verifyGeneric(header, body, secret, now)
+	}
+}
+
+// SetGenericSignature signs a webhook for the generic provider. The timestamp is set in
+// the httputil.SignatureTimestampHeader, and the httputil.SignatureHeader holds
+// "sha256=<hex>", the HMAC-SHA256 of the payload:
+//
+//	<timestamp>.<body>
+//
+// Unlike the callbacks signed by httputil.SetSignature, the X-Call-Id is not signed, as
+// the provider creates one for requests which do not have it.
+func SetGenericSignature(header http.Header, secret []byte, timestamp time.Time, body []byte) {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+
+	header.Set(httputil.SignatureTimestampHeader, unix)
+	header.Set(httputil.SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// verifyGeneric checks the signature headers of SetGenericSignature.
+func verifyGeneric(header http.Header, body, secret []byte, now time.Time) error {
+	timestamp := header.Get(httputil.SignatureTimestampHeader)
+	signature, ok := strings.CutPrefix(header.Get(httputil.SignatureHeader), "sha256=")
+	if timestamp == "" || !ok {
+		return httputil.ErrSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return httputil.ErrSignatureInvalid
+	}
+
+	if !validHexMAC(secret, append([]byte(timestamp+"."), body...), signature) {
+		return httputil.ErrSignatureInvalid
+	}
+
+	if age := now.Sub(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return httputil.ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// verifyGitHub checks a "sha256=<hex>" signature of the body.
+func verifyGitHub(header http.Header, body, secret []byte) error {
+	signature, ok := strings.CutPrefix(header.Get(githubSignatureHeader), "sha256=")
+	if !ok {
+		return errInvalidSignature
+	}
+
+	if !validHexMAC(secret, body, signature) {
+		return errInvalidSignature
+	}
+
+	return nil
+}
+
+// verifyStripe checks a "t=<timestamp>,v1=<hex>" signature of the timestamp and body,
+// any of the v1 signatures may match so that secrets can be rolled.
+func verifyStripe(header http.Header, body, secret []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+
+	for _, part := range strings.Split(header.Get(stripeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errInvalidSignature
+	}
+
+	payload := append([]byte(timestamp+"."), body...)
+
+	valid := false
+	for _, signature := range signatures {
+		if validHexMAC(secret, payload, signature) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return errInvalidSignature
+	}
+
+	if age := now.Sub(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return httputil.ErrSignatureExpired
+	}
+
+	return nil
+}
+
+func validHexMAC(secret, payload []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// deliveryID returns the identifier of the delivery, or "" when there is none.
+func deliveryID(provider Provider, header http.Header, body []byte) string {
+	switch provider {
+	case ProviderGitHub:
+		return header.Get(githubDeliveryHeader)
+	case ProviderStripe:
+		var event struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return ""
+		}
+		return event.ID
+	default:
+		return header.Get(DeliveryIDHeader)
+	}
+}
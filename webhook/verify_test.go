@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+func hexMAC(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Test_verify(t *testing.T) {
+	secret := "webhook-secret"
+	body := `{"id":"evt_1"}`
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	genericHeader := http.Header{}
+	SetGenericSignature(genericHeader, []byte(secret), now, []byte(body))
+
+	cases := []struct {
+		name     string
+		provider Provider
+		header   http.Header
+		now      time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "github valid",
+			provider: ProviderGitHub,
+			header:   http.Header{githubSignatureHeader: []string{"sha256=" + hexMAC(secret, body)}},
+			now:      now,
+		},
+		{
+			name:     "github wrong secret",
+			provider: ProviderGitHub,
+			header:   http.Header{githubSignatureHeader: []string{"sha256=" + hexMAC("other", body)}},
+			now:      now,
+			wantErr:  true,
+		},
+		{
+			name:     "github missing",
+			provider: ProviderGitHub,
+			header:   http.Header{},
+			now:      now,
+			wantErr:  true,
+		},
+		{
+			name:     "stripe valid",
+			provider: ProviderStripe,
+			header:   http.Header{stripeSignatureHeader: []string{"t=" + timestamp + ",v1=" + hexMAC(secret, timestamp+"."+body)}},
+			now:      now,
+		},
+		{
+			name:     "stripe rolled secret",
+			provider: ProviderStripe,
+			header: http.Header{stripeSignatureHeader: []string{
+				"t=" + timestamp + ",v1=" + hexMAC("old", timestamp+"."+body) + ",v1=" + hexMAC(secret, timestamp+"."+body),
+			}},
+			now: now,
+		},
+		{
+			name:     "stripe expired",
+			provider: ProviderStripe,
+			header:   http.Header{stripeSignatureHeader: []string{"t=" + timestamp + ",v1=" + hexMAC(secret, timestamp+"."+body)}},
+			now:      now.Add(time.Hour),
+			wantErr:  true,
+		},
+		{
+			name:     "generic valid",
+			provider: ProviderGeneric,
+			header:   genericHeader,
+			now:      now,
+		},
+		{
+			name:     "generic with call ID",
+			provider: ProviderGeneric,
+			header: func() http.Header {
+				h := genericHeader.Clone()
+				h.Set(httputil.CallIDHeader, "created-by-the-provider")
+				return h
+			}(),
+			now: now,
+		},
+		{
+			name:     "generic modified timestamp",
+			provider: ProviderGeneric,
+			header: func() http.Header {
+				h := genericHeader.Clone()
+				h.Set(httputil.SignatureTimestampHeader, strconv.FormatInt(now.Unix()+60, 10))
+				return h
+			}(),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:     "generic expired",
+			provider: ProviderGeneric,
+			header:   genericHeader,
+			now:      now.Add(time.Hour),
+			wantErr:  true,
+		},
+		{
+			name:     "generic missing",
+			provider: ProviderGeneric,
+			header:   http.Header{},
+			now:      now,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verify(tc.provider, tc.header, []byte(body), []byte(secret), tc.now)
+			if tc.wantErr && err == nil {
+				t.Error("want error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("want no error, got %s", err)
+			}
+		})
+	}
+}
+
+func Test_deliveryID(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider Provider
+		header   http.Header
+		body     string
+		want     string
+	}{
+		{name: "github", provider: ProviderGitHub, header: http.Header{http.CanonicalHeaderKey(githubDeliveryHeader): []string{"abc"}}, want: "abc"},
+		{name: "stripe", provider: ProviderStripe, header: http.Header{}, body: `{"id":"evt_1"}`, want: "evt_1"},
+		{name: "stripe invalid body", provider: ProviderStripe, header: http.Header{}, body: `not json`, want: ""},
+		{name: "generic", provider: ProviderGeneric, header: http.Header{DeliveryIDHeader: []string{"d-1"}}, want: "d-1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := deliveryID(tc.provider, tc.header, []byte(tc.body)); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}